@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	kotslicense "github.com/replicatedhq/kots/pkg/license"
+	"github.com/replicatedhq/kots/pkg/logger"
+	"github.com/replicatedhq/kots/pkg/releaseserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func DevCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dev",
+		Short: "tools for developing and testing kots applications",
+		Long:  ``,
+	}
+
+	cmd.AddCommand(DevServeCmd())
+
+	return cmd
+}
+
+func DevServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve [releases dir]",
+		Short: "serve local releases with the replicated.app release api",
+		Long: `Serve the releases in a local directory with the same api that replicated.app serves them with,
+so that replicated:// upstreams can be pulled and installed without the vendor portal.
+
+Each directory in the releases dir is a channel, and each directory in a channel is a release
+named by its sequence and, optionally, its version label:
+
+  releases/stable/1-v1.0.0/
+  releases/stable/2-v1.1.0/
+  releases/beta/1/`,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			if len(args) != 1 {
+				cmd.Help()
+				os.Exit(1)
+			}
+
+			log := logger.NewLogger()
+			log.Initialize()
+
+			licenses := []*kotsv1beta1.License{}
+			for _, licenseFile := range v.GetStringSlice("license") {
+				licenseData, err := ioutil.ReadFile(ExpandDir(licenseFile))
+				if err != nil {
+					return errors.Wrap(err, "failed to read license file")
+				}
+				license, err := kotslicense.ParseLicense(licenseData)
+				if err != nil {
+					return errors.Wrapf(err, "failed to parse license file %s", licenseFile)
+				}
+				licenses = append(licenses, license)
+			}
+
+			listener, err := net.Listen("tcp", v.GetString("address"))
+			if err != nil {
+				return errors.Wrap(err, "failed to listen")
+			}
+			endpoint := fmt.Sprintf("http://%s", listener.Addr().String())
+
+			if writeLicense := v.GetString("write-license"); writeLicense != "" {
+				if v.GetString("app-slug") == "" {
+					return errors.New("--app-slug is required to write a license")
+				}
+
+				license, err := releaseserver.NewLicense(v.GetString("app-slug"), endpoint)
+				if err != nil {
+					return errors.Wrap(err, "failed to create license")
+				}
+
+				kotsscheme.AddToScheme(scheme.Scheme)
+				s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
+				var b bytes.Buffer
+				if err := s.Encode(license, &b); err != nil {
+					return errors.Wrap(err, "failed to marshal license")
+				}
+
+				if signingKey := v.GetString("signing-key"); signingKey != "" {
+					keyData, err := ioutil.ReadFile(ExpandDir(signingKey))
+					if err != nil {
+						return errors.Wrap(err, "failed to read signing key")
+					}
+					privateKey, err := kotslicense.ParsePrivateKey(keyData)
+					if err != nil {
+						return errors.Wrap(err, "failed to parse signing key")
+					}
+
+					// the signature is made over the license as it's written without one.
+					// the signing key is both the app key and the global key, so the
+					// license is verified with its public key.
+					signature, err := kotslicense.Sign(b.Bytes(), privateKey, privateKey, "")
+					if err != nil {
+						return errors.Wrap(err, "failed to sign license")
+					}
+					license.Spec.Signature = signature
+
+					b.Reset()
+					if err := s.Encode(license, &b); err != nil {
+						return errors.Wrap(err, "failed to marshal signed license")
+					}
+				}
+
+				if err := ioutil.WriteFile(ExpandDir(writeLicense), b.Bytes(), 0644); err != nil {
+					return errors.Wrap(err, "failed to write license")
+				}
+				log.Info("Wrote a license for %s to %s", license.Spec.AppSlug, writeLicense)
+
+				licenses = append(licenses, license)
+			}
+
+			server, err := releaseserver.NewServer(ExpandDir(args[0]), licenses)
+			if err != nil {
+				return err
+			}
+
+			for _, release := range server.Releases {
+				log.Info("Serving %s sequence %d %s", release.Channel, release.Sequence, release.VersionLabel)
+			}
+			log.ActionWithoutSpinner("Listening on %s", endpoint)
+
+			return http.Serve(listener, server)
+		},
+	}
+
+	cmd.Flags().String("address", "localhost:3000", "the address to listen on")
+	cmd.Flags().StringSlice("license", []string{}, "a license file to accept, can be specified more than once")
+	cmd.Flags().String("write-license", "", "write a new license for the app that points at this server to the file, and accept it")
+	cmd.Flags().String("app-slug", "", "the slug of the app to write a license for")
+	cmd.Flags().String("signing-key", "", "pem encoded rsa private key to sign the written license with")
+
+	return cmd
+}
@@ -28,9 +28,10 @@ func DownloadCmd() *cobra.Command {
 			}
 
 			downloadOptions := download.DownloadOptions{
-				Namespace:  v.GetString("namespace"),
-				Kubeconfig: v.GetString("kubeconfig"),
-				Overwrite:  v.GetBool("overwrite"),
+				Namespace:         v.GetString("namespace"),
+				Kubeconfig:        v.GetString("kubeconfig"),
+				Overwrite:         v.GetBool("overwrite"),
+				HTTPClientOptions: httpClientOptionsFromFlags(v),
 			}
 
 			if err := download.Download(appSlug, ExpandDir(v.GetString("dest")), downloadOptions); err != nil {
@@ -45,6 +46,7 @@ func DownloadCmd() *cobra.Command {
 	cmd.Flags().String("namespace", "default", "the namespace to download from")
 	cmd.Flags().String("dest", homeDir(), "the directory to store the application in")
 	cmd.Flags().Bool("overwrite", false, "overwrite any local files, if present")
+	addHTTPClientFlags(cmd)
 
 	return cmd
 }
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/replicatedhq/kots/pkg/base"
+	"github.com/replicatedhq/kots/pkg/pull"
+	"github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func addHelmRepoAuthFlags(cmd *cobra.Command) {
+	cmd.Flags().String("repo-username", "", "username to use when authenticating to the helm repo")
+	cmd.Flags().String("repo-password", "", "password to use when authenticating to the helm repo")
+	cmd.Flags().String("repo-cert-file", "", "client certificate file to use when connecting to the helm repo")
+	cmd.Flags().String("repo-key-file", "", "client key file to use when connecting to the helm repo")
+	cmd.Flags().String("repo-ca-file", "", "ca bundle to use to verify the helm repo certificate")
+	cmd.Flags().Bool("repo-insecure-skip-tls-verify", false, "skip verification of the helm repo certificate")
+	cmd.Flags().String("repositories-file", upstream.DefaultHelmReposFile(), "the file that helm repos added with kots repo add are stored in")
+}
+
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().String("cache-dir", upstream.DefaultCacheDir(), "directory to cache helm repo indexes and charts in")
+	cmd.Flags().Bool("offline", false, "only use helm repo indexes and charts from the cache, failing if they have not been downloaded before")
+}
+
+func addHelmValuesFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayP("values", "f", []string{}, "values file to render helm charts with, can be repeated")
+	cmd.Flags().StringArray("set", []string{}, "values to render helm charts with, in the same format as helm template --set")
+	cmd.Flags().StringArray("set-string", []string{}, "string values to render helm charts with, in the same format as helm template --set-string")
+	cmd.Flags().Bool("include-helm-tests", false, "include helm test hooks in the base")
+}
+
+// helmValuesFromFlags reads the values from the flags directly, because viper
+// doesn't support string array flags, and --set values can contain commas
+func helmValuesFromFlags(cmd *cobra.Command) (pull.HelmValues, error) {
+	valuesFiles, err := cmd.Flags().GetStringArray("values")
+	if err != nil {
+		return pull.HelmValues{}, err
+	}
+	set, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		return pull.HelmValues{}, err
+	}
+	setString, err := cmd.Flags().GetStringArray("set-string")
+	if err != nil {
+		return pull.HelmValues{}, err
+	}
+
+	return pull.HelmValues{
+		ValuesFiles: expandDirs(valuesFiles),
+		Set:         set,
+		SetString:   setString,
+	}, nil
+}
+
+func addCapabilitiesFlags(cmd *cobra.Command) {
+	cmd.Flags().String("kube-version", "", fmt.Sprintf("kubernetes version to render helm charts for (default %s)", base.DefaultKubeVersion))
+	cmd.Flags().StringSlice("api-versions", []string{}, "api versions to render helm charts for, in addition to v1")
+	cmd.Flags().Bool("discover-capabilities", false, "discover the kubernetes version and api versions from the cluster in the kubeconfig, when they are not set")
+}
+
+func capabilitiesFromFlags(v *viper.Viper) pull.Capabilities {
+	return pull.Capabilities{
+		KubeVersion: v.GetString("kube-version"),
+		APIVersions: v.GetStringSlice("api-versions"),
+		Discover:    v.GetBool("discover-capabilities"),
+		Kubeconfig:  ExpandDir(v.GetString("kubeconfig")),
+	}
+}
+
+func helmRepoAuthFromFlags(v *viper.Viper) pull.HelmRepoAuth {
+	return pull.HelmRepoAuth{
+		Username:           v.GetString("repo-username"),
+		Password:           v.GetString("repo-password"),
+		CertFile:           ExpandDir(v.GetString("repo-cert-file")),
+		KeyFile:            ExpandDir(v.GetString("repo-key-file")),
+		CAFile:             ExpandDir(v.GetString("repo-ca-file")),
+		InsecureSkipVerify: v.GetBool("repo-insecure-skip-tls-verify"),
+	}
+}
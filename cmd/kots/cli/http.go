@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"github.com/replicatedhq/kots/pkg/httpclient"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func addHTTPClientFlags(cmd *cobra.Command) {
+	cmd.Flags().String("https-proxy", "", "proxy to use for https requests, overrides the HTTPS_PROXY environment variable")
+	cmd.Flags().String("no-proxy", "", "hosts that should not be proxied, overrides the NO_PROXY environment variable")
+	cmd.Flags().String("ca-file", "", "ca bundle to trust in addition to the system cas, for proxies that intercept tls")
+	cmd.Flags().Duration("http-timeout", httpclient.DefaultTimeout, "timeout for each http request, including retries")
+	cmd.Flags().Int("http-retries", httpclient.DefaultMaxRetries, "number of times to retry GET, HEAD and PUT requests that fail with a 5xx or a connection reset")
+}
+
+func httpClientOptionsFromFlags(v *viper.Viper) httpclient.Options {
+	options := httpclient.Options{
+		HTTPSProxy: v.GetString("https-proxy"),
+		NoProxy:    v.GetString("no-proxy"),
+		CAFile:     ExpandDir(v.GetString("ca-file")),
+		Timeout:    v.GetDuration("http-timeout"),
+		MaxRetries: v.GetInt("http-retries"),
+	}
+
+	// zero means the default in the options, but on the command line it means none
+	if options.Timeout == 0 {
+		options.Timeout = -1
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = -1
+	}
+
+	return options
+}
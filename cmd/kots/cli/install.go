@@ -10,11 +10,13 @@ import (
 
 	"github.com/ahmetalpbalkan/go-cursor"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/base"
 	"github.com/replicatedhq/kots/pkg/k8sutil"
 	"github.com/replicatedhq/kots/pkg/kotsadm"
 	"github.com/replicatedhq/kots/pkg/logger"
 	"github.com/replicatedhq/kots/pkg/pull"
 	"github.com/replicatedhq/kots/pkg/upload"
+	"github.com/replicatedhq/kots/pkg/upstream"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -46,16 +48,32 @@ func InstallCmd() *cobra.Command {
 			}
 			defer os.RemoveAll(rootDir)
 
+			helmValues, err := helmValuesFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
 			pullOptions := pull.PullOptions{
-				HelmRepoURI: v.GetString("repo"),
-				RootDir:     rootDir,
-				Namespace:   v.GetString("namespace"),
+				HelmRepoURI:        v.GetString("repo"),
+				HelmRepoAuth:       helmRepoAuthFromFlags(v),
+				HelmReposFile:      ExpandDir(v.GetString("repositories-file")),
+				IncludePrereleases: v.GetBool("include-prereleases"),
+				CacheDir:           ExpandDir(v.GetString("cache-dir")),
+				Offline:            v.GetBool("offline"),
+				RootDir:            rootDir,
+				Namespace:          v.GetString("namespace"),
 				Downstreams: []string{
 					"local", // this is the auto-generated operator downstream
 				},
-				LocalPath:           ExpandDir(v.GetString("local-path")),
-				LicenseFile:         ExpandDir(v.GetString("license-file")),
-				ExcludeAdminConsole: true,
+				LocalPath:               ExpandDir(v.GetString("local-path")),
+				LicenseFile:             ExpandDir(v.GetString("license-file")),
+				LicensePublicKeyFiles:   expandDirs(v.GetStringSlice("license-public-key")),
+				SkipLicenseVerification: v.GetBool("skip-license-verification"),
+				ExcludeAdminConsole:     true,
+				HelmValues:              helmValues,
+				IncludeHelmTests:        v.GetBool("include-helm-tests"),
+				Capabilities:            capabilitiesFromFlags(v),
+				HTTPClientOptions:       httpClientOptionsFromFlags(v),
 			}
 
 			canPull, err := pull.CanPullUpstream(args[0], pullOptions)
@@ -63,15 +81,24 @@ func InstallCmd() *cobra.Command {
 				return err
 			}
 
+			var applicationMetadata []byte
 			if canPull {
 				if _, err := pull.Pull(args[0], pullOptions); err != nil {
 					return err
 				}
+
+				// the metadata was cached with the upstream when it was pulled
+				applicationMetadata, err = upstream.ReadApplicationMetadata(rootDir)
+				if err != nil {
+					return err
+				}
 			}
 
-			applicationMetadata, err := pull.PullApplicationMetadata(args[0])
-			if err != nil {
-				return err
+			if applicationMetadata == nil {
+				applicationMetadata, err = pull.PullApplicationMetadata(args[0], pullOptions)
+				if err != nil {
+					return err
+				}
 			}
 
 			deployOptions := kotsadm.DeployOptions{
@@ -94,11 +121,14 @@ func InstallCmd() *cobra.Command {
 
 			// upload the kots app to kotsadm
 			uploadOptions := upload.UploadOptions{
-				Namespace:    v.GetString("namespace"),
-				Kubeconfig:   v.GetString("kubeconfig"),
-				NewAppName:   v.GetString("name"),
-				VersionLabel: "todo",
-				UpstreamURI:  args[0],
+				Namespace:               v.GetString("namespace"),
+				Kubeconfig:              v.GetString("kubeconfig"),
+				NewAppName:              v.GetString("name"),
+				VersionLabel:            "todo",
+				UpstreamURI:             args[0],
+				LicensePublicKeyFiles:   expandDirs(v.GetStringSlice("license-public-key")),
+				SkipLicenseVerification: v.GetBool("skip-license-verification"),
+				HTTPClientOptions:       httpClientOptionsFromFlags(v),
 			}
 
 			if canPull {
@@ -128,6 +158,12 @@ func InstallCmd() *cobra.Command {
 				if err := upload.Upload(uploadRootDir, uploadOptions); err != nil {
 					return errors.Cause(err)
 				}
+
+				// the admin console deploys the downstream, hooks that run before it
+				// are left to the user
+				if _, err := os.Stat(path.Join(uploadRootDir, "overlays", "downstreams", "local", base.HooksDir)); err == nil {
+					log.Info("The application has pre-install hooks that the Admin Console does not apply. To run them, pull the application with kubectl kots pull and run kubectl apply -k on its hooks directory before deploying.")
+				}
 			}
 
 			// port forward
@@ -172,9 +208,16 @@ func InstallCmd() *cobra.Command {
 	cmd.Flags().String("name", "", "name of the application to use in the Admin Console")
 	cmd.Flags().String("local-path", "", "specify a local-path to test the behavior of rendering a replicated app locally (only supported on replicated app types currently)")
 	cmd.Flags().String("license-file", "", "path to a license file to use when download a replicated app")
+	cmd.Flags().StringSlice("license-public-key", []string{}, "pem file with a vendor public key to verify the license signature with")
+	cmd.Flags().Bool("skip-license-verification", false, "trust the license without verifying its signature")
 
 	cmd.Flags().String("repo", "", "repo uri to use when installing a helm chart")
-	cmd.Flags().StringArray("set", []string{}, "values to pass to helm when running helm template")
+	addHelmRepoAuthFlags(cmd)
+	addHelmValuesFlags(cmd)
+	addCapabilitiesFlags(cmd)
+	cmd.Flags().Bool("include-prereleases", false, "consider prerelease chart versions when resolving the version of a helm chart")
+	addCacheFlags(cmd)
+	addHTTPClientFlags(cmd)
 
 	return cmd
 }
@@ -3,7 +3,9 @@ package cli
 import (
 	"os"
 	"path"
+	"path/filepath"
 
+	"github.com/replicatedhq/kots/pkg/base"
 	"github.com/replicatedhq/kots/pkg/logger"
 	"github.com/replicatedhq/kots/pkg/pull"
 	"github.com/spf13/cobra"
@@ -28,17 +30,33 @@ func PullCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
+			helmValues, err := helmValuesFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
 			pullOptions := pull.PullOptions{
-				HelmRepoURI:         v.GetString("repo"),
-				RootDir:             ExpandDir(v.GetString("rootdir")),
-				Namespace:           v.GetString("namespace"),
-				Downstreams:         v.GetStringSlice("downstream"),
-				LocalPath:           ExpandDir(v.GetString("local-path")),
-				LicenseFile:         ExpandDir(v.GetString("license-file")),
-				ExcludeKotsKinds:    v.GetBool("exclude-kots-kinds"),
-				ExcludeAdminConsole: v.GetBool("exclude-admin-console"),
-				SharedPassword:      v.GetString("shared-password"),
-				CreateAppDir:        true,
+				HelmRepoURI:             v.GetString("repo"),
+				HelmRepoAuth:            helmRepoAuthFromFlags(v),
+				HelmReposFile:           ExpandDir(v.GetString("repositories-file")),
+				IncludePrereleases:      v.GetBool("include-prereleases"),
+				CacheDir:                ExpandDir(v.GetString("cache-dir")),
+				Offline:                 v.GetBool("offline"),
+				RootDir:                 ExpandDir(v.GetString("rootdir")),
+				Namespace:               v.GetString("namespace"),
+				Downstreams:             v.GetStringSlice("downstream"),
+				LocalPath:               ExpandDir(v.GetString("local-path")),
+				LicenseFile:             ExpandDir(v.GetString("license-file")),
+				LicensePublicKeyFiles:   expandDirs(v.GetStringSlice("license-public-key")),
+				SkipLicenseVerification: v.GetBool("skip-license-verification"),
+				ExcludeKotsKinds:        v.GetBool("exclude-kots-kinds"),
+				ExcludeAdminConsole:     v.GetBool("exclude-admin-console"),
+				SharedPassword:          v.GetString("shared-password"),
+				CreateAppDir:            true,
+				HelmValues:              helmValues,
+				IncludeHelmTests:        v.GetBool("include-helm-tests"),
+				Capabilities:            capabilitiesFromFlags(v),
+				HTTPClientOptions:       httpClientOptionsFromFlags(v),
 			}
 
 			renderDir, err := pull.Pull(args[0], pullOptions)
@@ -49,10 +67,19 @@ func PullCmd() *cobra.Command {
 			log := logger.NewLogger()
 			log.Initialize()
 			log.Info("Kubernetes application files created in %s", renderDir)
+			deployDir := ""
 			if len(v.GetStringSlice("downstream")) == 0 {
-				log.Info("To deploy, run kubectl apply -k %s", path.Join(renderDir, "overlays", "midstream"))
+				deployDir = path.Join(renderDir, "overlays", "midstream")
 			} else if len(v.GetStringSlice("downstream")) == 1 {
-				log.Info("To deploy, run kubectl apply -k %s", path.Join(renderDir, "overlays", "downstreams", v.GetStringSlice("downstream")[0]))
+				deployDir = path.Join(renderDir, "overlays", "downstreams", v.GetStringSlice("downstream")[0])
+			}
+
+			if deployDir != "" {
+				hooksDir := path.Join(deployDir, base.HooksDir)
+				if _, err := os.Stat(hooksDir); err == nil {
+					log.Info("To run the pre-install hooks, run kubectl apply -k %s before deploying", hooksDir)
+				}
+				log.Info("To deploy, run kubectl apply -k %s", deployDir)
 			} else {
 				log.Info("To deploy, run kubectl apply -k from the downstream directory you would like to deploy")
 			}
@@ -61,13 +88,21 @@ func PullCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringArray("set", []string{}, "values to pass to helm when running helm template")
 	cmd.Flags().String("repo", "", "repo uri to use when downloading a helm chart")
+	addHelmRepoAuthFlags(cmd)
+	addHelmValuesFlags(cmd)
+	addCapabilitiesFlags(cmd)
+	cmd.Flags().Bool("include-prereleases", false, "consider prerelease chart versions when resolving the version of a helm chart")
+	addCacheFlags(cmd)
+	addHTTPClientFlags(cmd)
 	cmd.Flags().String("rootdir", homeDir(), "root directory that will be used to write the yaml to")
 	cmd.Flags().String("namespace", "default", "namespace to render the upstream to in the base")
+	cmd.Flags().String("kubeconfig", filepath.Join(homeDir(), ".kube", "config"), "the kubeconfig to discover capabilities with")
 	cmd.Flags().StringSlice("downstream", []string{}, "the list of any downstreams to create/update")
 	cmd.Flags().String("local-path", "", "specify a local-path to test the behavior of rendering a replicated app locally (only supported on replicated app types currently)")
 	cmd.Flags().String("license-file", "", "path to a license file to use when download a replicated app")
+	cmd.Flags().StringSlice("license-public-key", []string{}, "pem file with a vendor public key to verify the license signature with")
+	cmd.Flags().Bool("skip-license-verification", false, "trust the license without verifying its signature")
 	cmd.Flags().Bool("exclude-kots-kinds", true, "set to true to exclude rendering kots custom objects to the base directory")
 	cmd.Flags().Bool("exclude-admin-console", false, "set to true to exclude the admin console (replicated apps only)")
 	cmd.Flags().String("shared-password", "", "shared password to use when deploying the admin console")
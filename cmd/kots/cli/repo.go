@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/replicatedhq/kots/pkg/logger"
+	"github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func RepoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "manage the helm repos that helm:// upstreams can refer to by name",
+		Long:  ``,
+	}
+
+	cmd.PersistentFlags().String("repositories-file", upstream.DefaultHelmReposFile(), "the file that helm repos are stored in")
+
+	cmd.AddCommand(RepoAddCmd())
+	cmd.AddCommand(RepoListCmd())
+	cmd.AddCommand(RepoRemoveCmd())
+	cmd.AddCommand(RepoImportCmd())
+
+	return cmd
+}
+
+func RepoAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "add [name] [url]",
+		Short:         "add a helm repo",
+		Long:          ``,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			if len(args) != 2 {
+				cmd.Help()
+				os.Exit(1)
+			}
+
+			reposFile := ExpandDir(v.GetString("repositories-file"))
+			helmRepos, err := upstream.LoadHelmRepos(reposFile)
+			if err != nil {
+				return err
+			}
+
+			helmRepo := upstream.HelmRepo{
+				Name:     args[0],
+				URL:      args[1],
+				Username: v.GetString("username"),
+				Password: v.GetString("password"),
+				CertFile: ExpandDir(v.GetString("cert-file")),
+				KeyFile:  ExpandDir(v.GetString("key-file")),
+				CAFile:   ExpandDir(v.GetString("ca-file")),
+			}
+			if err := helmRepos.Add(helmRepo); err != nil {
+				return err
+			}
+
+			if err := helmRepos.Save(reposFile); err != nil {
+				return err
+			}
+
+			log := logger.NewLogger()
+			log.Initialize()
+			log.Info("%q has been added to your repositories", args[0])
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("username", "", "username to use when authenticating to the helm repo")
+	cmd.Flags().String("password", "", "password to use when authenticating to the helm repo")
+	cmd.Flags().String("cert-file", "", "client certificate file to use when connecting to the helm repo")
+	cmd.Flags().String("key-file", "", "client key file to use when connecting to the helm repo")
+	cmd.Flags().String("ca-file", "", "ca bundle to use to verify the helm repo certificate")
+
+	return cmd
+}
+
+func RepoListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "list",
+		Short:         "list the helm repos",
+		Long:          ``,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			helmRepos, err := upstream.LoadHelmRepos(ExpandDir(v.GetString("repositories-file")))
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tURL")
+			for _, helmRepo := range helmRepos.Repositories {
+				fmt.Fprintf(w, "%s\t%s\n", helmRepo.Name, helmRepo.URL)
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func RepoRemoveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "remove [name]",
+		Short:         "remove a helm repo",
+		Long:          ``,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			if len(args) != 1 {
+				cmd.Help()
+				os.Exit(1)
+			}
+
+			reposFile := ExpandDir(v.GetString("repositories-file"))
+			helmRepos, err := upstream.LoadHelmRepos(reposFile)
+			if err != nil {
+				return err
+			}
+
+			if err := helmRepos.Remove(args[0]); err != nil {
+				return err
+			}
+
+			if err := helmRepos.Save(reposFile); err != nil {
+				return err
+			}
+
+			log := logger.NewLogger()
+			log.Initialize()
+			log.Info("%q has been removed from your repositories", args[0])
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func RepoImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "import",
+		Short:         "import the repos that have been added to the helm client",
+		Long:          ``,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			imported, err := upstream.ImportHelmRepositories(ExpandDir(v.GetString("helm-repositories-file")))
+			if err != nil {
+				return err
+			}
+
+			reposFile := ExpandDir(v.GetString("repositories-file"))
+			helmRepos, err := upstream.LoadHelmRepos(reposFile)
+			if err != nil {
+				return err
+			}
+
+			log := logger.NewLogger()
+			log.Initialize()
+
+			for _, helmRepo := range imported {
+				if helmRepos.Get(helmRepo.Name) != nil && !v.GetBool("overwrite") {
+					log.Info("Skipping %q, it has already been added", helmRepo.Name)
+					continue
+				}
+
+				if err := helmRepos.Add(helmRepo); err != nil {
+					return err
+				}
+				log.Info("%q has been added to your repositories", helmRepo.Name)
+			}
+
+			return helmRepos.Save(reposFile)
+		},
+	}
+
+	cmd.Flags().String("helm-repositories-file", upstream.DefaultHelmRepositoriesFile(), "the helm client repositories.yaml to import from")
+	cmd.Flags().Bool("overwrite", false, "replace repos that have already been added with the same name")
+
+	return cmd
+}
@@ -26,6 +26,10 @@ func RootCmd() *cobra.Command {
 	cmd.AddCommand(UploadCmd())
 	cmd.AddCommand(DownloadCmd())
 	cmd.AddCommand(AdminConsoleCmd())
+	cmd.AddCommand(RepoCmd())
+	cmd.AddCommand(UpstreamCmd())
+	cmd.AddCommand(VerifyCmd())
+	cmd.AddCommand(DevCmd())
 
 	viper.BindPFlags(cmd.Flags())
 
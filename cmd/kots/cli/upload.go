@@ -29,11 +29,15 @@ func UploadCmd() *cobra.Command {
 			}
 
 			uploadOptions := upload.UploadOptions{
-				Namespace:       v.GetString("namespace"),
-				Kubeconfig:      v.GetString("kubeconfig"),
-				ExistingAppSlug: v.GetString("slug"),
-				NewAppName:      v.GetString("name"),
-				UpstreamURI:     v.GetString("upstream-uri"),
+				Namespace:               v.GetString("namespace"),
+				Kubeconfig:              v.GetString("kubeconfig"),
+				ExistingAppSlug:         v.GetString("slug"),
+				NewAppName:              v.GetString("name"),
+				UpstreamURI:             v.GetString("upstream-uri"),
+				LicensePublicKeyFiles:   expandDirs(v.GetStringSlice("license-public-key")),
+				SkipLicenseVerification: v.GetBool("skip-license-verification"),
+				SkipVerify:              v.GetBool("skip-verify"),
+				HTTPClientOptions:       httpClientOptionsFromFlags(v),
 			}
 
 			if err := upload.Upload(ExpandDir(args[0]), uploadOptions); err != nil {
@@ -49,6 +53,10 @@ func UploadCmd() *cobra.Command {
 	cmd.Flags().String("slug", "", "the application slug to use. if not present, a new one will be created")
 	cmd.Flags().String("name", "", "the name of the kotsadm application to create")
 	cmd.Flags().String("upstream-uri", "", "the upstream uri that can be used to check for updates")
+	cmd.Flags().StringSlice("license-public-key", []string{}, "pem file with a vendor public key to verify the license signature with")
+	cmd.Flags().Bool("skip-license-verification", false, "trust the license without verifying its signature")
+	cmd.Flags().Bool("skip-verify", false, "upload even if the upstream files don't match the checksums that were written when the app was pulled")
+	addHTTPClientFlags(cmd)
 
 	return cmd
 }
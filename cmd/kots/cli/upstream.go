@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/pull"
+	"github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type upstreamCheckOutput struct {
+	Upstream      string            `json:"upstream"`
+	CurrentCursor string            `json:"currentCursor"`
+	Updates       []upstream.Update `json:"updates"`
+}
+
+func UpstreamCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upstream",
+		Short: "commands for the upstream of an app that has been pulled",
+		Long:  ``,
+	}
+
+	cmd.AddCommand(UpstreamCheckCmd())
+
+	return cmd
+}
+
+func UpstreamCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "check [app dir]",
+		Short:         "list the versions of the upstream that are newer than the version that was pulled",
+		Long:          ``,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			appDir := "."
+			if len(args) > 0 {
+				appDir = ExpandDir(args[0])
+			}
+
+			installation, err := upstream.ReadInstallation(appDir)
+			if err != nil {
+				return err
+			}
+
+			upstreamURI := v.GetString("upstream")
+			if upstreamURI == "" {
+				upstreamURI = installation.Spec.UpstreamURI
+			}
+			if upstreamURI == "" {
+				return errors.New("--upstream is required")
+			}
+
+			licenseFile := ExpandDir(v.GetString("license-file"))
+			if licenseFile == "" {
+				pulledLicenseFile := filepath.Join(appDir, "upstream", "userdata", "license.yaml")
+				if _, err := os.Stat(pulledLicenseFile); err == nil {
+					licenseFile = pulledLicenseFile
+				}
+			}
+
+			pullOptions := pull.PullOptions{
+				HelmRepoURI:             v.GetString("repo"),
+				HelmRepoAuth:            helmRepoAuthFromFlags(v),
+				HelmReposFile:           ExpandDir(v.GetString("repositories-file")),
+				IncludePrereleases:      v.GetBool("include-prereleases"),
+				CacheDir:                ExpandDir(v.GetString("cache-dir")),
+				Offline:                 v.GetBool("offline"),
+				LicenseFile:             licenseFile,
+				LicensePublicKeyFiles:   expandDirs(v.GetStringSlice("license-public-key")),
+				SkipLicenseVerification: v.GetBool("skip-license-verification"),
+				HTTPClientOptions:       httpClientOptionsFromFlags(v),
+			}
+
+			updates, err := pull.ListUpdates(upstreamURI, installation.Spec.UpdateCursor, pullOptions)
+			if err != nil {
+				return err
+			}
+
+			output := upstreamCheckOutput{
+				Upstream:      upstreamURI,
+				CurrentCursor: installation.Spec.UpdateCursor,
+				Updates:       updates,
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(output)
+		},
+	}
+
+	cmd.Flags().String("upstream", "", "the upstream uri that the app was pulled from, defaults to the upstream in the installation")
+	cmd.Flags().String("license-file", "", "path to a license file to use, defaults to the license that the app was pulled with")
+	cmd.Flags().StringSlice("license-public-key", []string{}, "pem file with a vendor public key to verify the license signature with")
+	cmd.Flags().Bool("skip-license-verification", false, "trust the license without verifying its signature")
+	cmd.Flags().String("repo", "", "repo uri to use when checking a helm chart")
+	addHelmRepoAuthFlags(cmd)
+	cmd.Flags().Bool("include-prereleases", false, "consider prerelease chart versions when listing the versions of a helm chart")
+	addCacheFlags(cmd)
+	addHTTPClientFlags(cmd)
+
+	return cmd
+}
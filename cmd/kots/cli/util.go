@@ -14,6 +14,15 @@ func ExpandDir(input string) string {
 	return path.Join(homeDir(), input[1:])
 }
 
+func expandDirs(inputs []string) []string {
+	expanded := []string{}
+	for _, input := range inputs {
+		expanded = append(expanded, ExpandDir(input))
+	}
+
+	return expanded
+}
+
 func homeDir() string {
 	if h := os.Getenv("HOME"); h != "" {
 		return h
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/logger"
+	"github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func VerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify [app dir]",
+		Short: "check that the upstream files in an app dir haven't changed since it was pulled",
+		Long: `Compare the files in the upstream dir of a pulled app to the checksums that were written when
+it was pulled, and list the files that were modified, removed or added. Files in upstream/userdata,
+base and overlays can be changed.`,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			appDir := "."
+			if len(args) > 0 {
+				appDir = ExpandDir(args[0])
+			}
+
+			diff, err := upstream.VerifyUpstream(appDir)
+			if err == upstream.ErrNoChecksums {
+				return errors.New("no upstream checksums were found, pull the app again to write them")
+			}
+			if err != nil {
+				return err
+			}
+
+			log := logger.NewLogger()
+			if diff.IsEmpty() {
+				log.Info("The upstream files in %s match the checksums", appDir)
+				return nil
+			}
+
+			for _, filename := range diff.Modified {
+				log.ActionWithoutSpinner("modified: %s", filename)
+			}
+			for _, filename := range diff.Missing {
+				log.ActionWithoutSpinner("missing: %s", filename)
+			}
+			for _, filename := range diff.Extra {
+				log.ActionWithoutSpinner("extra: %s", filename)
+			}
+			log.ActionWithoutSpinner("")
+
+			return errors.New("the upstream files don't match the checksums")
+		},
+	}
+
+	return cmd
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/replicatedhq/kots/cmd/kots/cli"
+	_ "github.com/replicatedhq/kots/pkg/kustomize"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 )
 
@@ -3,10 +3,7 @@ package main
 import "C"
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -17,10 +14,15 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/mholt/archiver"
 	"github.com/pkg/errors"
-	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
-	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	"github.com/replicatedhq/kots/pkg/archive"
+	"github.com/replicatedhq/kots/pkg/httpclient"
+	kotslicense "github.com/replicatedhq/kots/pkg/license"
 	"github.com/replicatedhq/kots/pkg/pull"
-	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	maxAirgapBundleFiles = 100000
+	maxAirgapBundleSize  = 64 * 1024 * 1024 * 1024
 )
 
 type ImageRef struct {
@@ -115,14 +117,16 @@ func PullFromAirgap(licenseData, airgapDir, downstream, outputFile, registryHost
 		return 1
 	}
 
-	kotsscheme.AddToScheme(scheme.Scheme)
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	obj, _, err := decode([]byte(licenseData), nil, nil)
+	license, err := kotslicense.ParseLicense([]byte(licenseData))
 	if err != nil {
-		fmt.Printf("failed to decode license data: %s\n", err.Error())
+		fmt.Printf("failed to parse license: %s\n", err.Error())
+		return 1
+	}
+
+	if err := verifyLicense(license); err != nil {
+		fmt.Printf("failed to verify license: %s\n", err.Error())
 		return 1
 	}
-	license := obj.(*kotsv1beta1.License)
 
 	licenseFile, err := ioutil.TempFile("", "kots")
 	if err != nil {
@@ -145,12 +149,14 @@ func PullFromAirgap(licenseData, airgapDir, downstream, outputFile, registryHost
 	defer os.RemoveAll(tmpRoot)
 
 	pullOptions := pull.PullOptions{
-		Downstreams:         []string{downstream},
-		LocalPath:           releaseDir,
-		LicenseFile:         licenseFile.Name(),
-		ExcludeKotsKinds:    true,
-		RootDir:             tmpRoot,
-		ExcludeAdminConsole: true,
+		Downstreams:             []string{downstream},
+		LocalPath:               releaseDir,
+		LicenseFile:             licenseFile.Name(),
+		LicensePublicKeyFiles:   licensePublicKeyFiles(),
+		SkipLicenseVerification: skipLicenseVerification(),
+		ExcludeKotsKinds:        true,
+		RootDir:                 tmpRoot,
+		ExcludeAdminConsole:     true,
 		RewriteImages: pull.RewriteImages{
 			ImageFiles: filepath.Join(airgapDir, "images"),
 			Host:       registryHost,
@@ -187,62 +193,35 @@ func PullFromAirgap(licenseData, airgapDir, downstream, outputFile, registryHost
 }
 
 func downloadAirgapAchive(workspace string, airgapURL string) (string, error) {
-	resp, err := http.Get(airgapURL)
+	// airgap bundles can take much longer to download than the default timeout
+	client, err := httpclient.New(httpclient.Options{
+		Timeout: -1,
+	})
 	if err != nil {
-		return "", errors.Wrap(err, "failed to download file")
+		return "", errors.Wrap(err, "failed to create http client")
 	}
 
-	destDir := filepath.Join(workspace, "extracted-airgap")
-	if err := os.Mkdir(destDir, 0744); err != nil {
-		return "", errors.Wrap(err, "failed to create tmp dir")
+	resp, err := client.Get(airgapURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download file")
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", errors.Wrapf(err, "unexpected status code: %v", resp.StatusCode)
+		return "", errors.Errorf("unexpected status code: %v", resp.StatusCode)
 	}
-	defer resp.Body.Close()
 
-	gzipReader, err := gzip.NewReader(resp.Body)
-	if err != nil {
-		return "", errors.Wrapf(err, "unexpected status code: %v", resp.StatusCode)
+	destDir := filepath.Join(workspace, "extracted-airgap")
+	if err := os.Mkdir(destDir, 0744); err != nil {
+		return "", errors.Wrap(err, "failed to create tmp dir")
 	}
-	defer gzipReader.Close()
 
-	tarReader := tar.NewReader(gzipReader)
-	for {
-		hdr, err := tarReader.Next()
-		if err == io.EOF {
-			break // End of archive
-		}
-		if err != nil {
-			return "", errors.Wrap(err, "failed to expand archive")
-		}
-
-		if hdr.Typeflag != tar.TypeReg {
-			// we don't expat anything but files in our archives...
-			continue
-		}
-
-		fileName := filepath.Join(destDir, hdr.Name)
-		if err := os.MkdirAll(filepath.Dir(fileName), 0744); err != nil {
-			return "", errors.Wrapf(err, "failed to create path %q", filepath.Dir(fileName))
-		}
-
-		err = func() error { // func so we can defer close files... /shrug
-			fileWriter, err := os.Create(fileName)
-			if err != nil {
-				return errors.Wrapf(err, "failed to create file %q", fileName)
-			}
-			defer fileWriter.Close()
-
-			if _, err := io.Copy(fileWriter, tarReader); err != nil {
-				return errors.Wrapf(err, "failed to write file %q", fileName)
-			}
-			return nil
-		}()
-		if err != nil {
-			return "", err
-		}
+	// airgap bundles carry images, so they are allowed to be much larger than a release
+	if err := archive.ExtractTarGz(resp.Body, destDir, archive.Options{
+		MaxFiles: maxAirgapBundleFiles,
+		MaxSize:  maxAirgapBundleSize,
+	}); err != nil {
+		return "", errors.Wrap(err, "failed to expand archive")
 	}
 
 	return destDir, nil
@@ -280,48 +259,8 @@ func extractAppRelease(workspace string, airgapDir string) (string, error) {
 }
 
 func extractOneArchive(tgzFile string, destDir string) error {
-	fileReader, err := os.Open(tgzFile)
-	if err != nil {
-		return errors.Wrap(err, "failed to open release file")
-	}
-
-	gzReader, err := gzip.NewReader(fileReader)
-	if err != nil {
-		return errors.Wrap(err, "failed to create gzip reader")
-	}
-
-	tarReader := tar.NewReader(gzReader)
-	for {
-		hdr, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return errors.Wrap(err, "failed to read release tar")
-		}
-
-		if hdr.Typeflag != tar.TypeReg {
-			continue
-		}
-
-		err = func() error {
-			fileName := filepath.Join(destDir, hdr.Name)
-			fileWriter, err := os.Create(fileName)
-			if err != nil {
-				return errors.Wrapf(err, "failed to create file %q", hdr.Name)
-			}
-			defer fileWriter.Close()
-
-			_, err = io.Copy(fileWriter, tarReader)
-			if err != nil {
-				return errors.Wrapf(err, "failed to write file %q", hdr.Name)
-			}
-
-			return nil
-		}()
-		if err != nil {
-			return err
-		}
+	if err := archive.ExtractTarGzFile(tgzFile, destDir, archive.Options{}); err != nil {
+		return errors.Wrap(err, "failed to extract release tar")
 	}
 
 	return nil
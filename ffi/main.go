@@ -7,11 +7,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/mholt/archiver"
 	"github.com/pkg/errors"
 	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
 	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	_ "github.com/replicatedhq/kots/pkg/kustomize"
+	kotslicense "github.com/replicatedhq/kots/pkg/license"
 	"github.com/replicatedhq/kots/pkg/pull"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -54,21 +57,35 @@ func UpdateCheck(fromArchivePath string) int {
 		return -1
 	}
 
-	kotsscheme.AddToScheme(scheme.Scheme)
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	obj, _, err := decode([]byte(licenseData), nil, nil)
+	license, err := kotslicense.ParseLicense([]byte(licenseData))
 	if err != nil {
-		fmt.Printf("failed to decode license data: %s\n", err.Error())
+		fmt.Printf("failed to parse license: %s\n", err.Error())
+		return -1
+	}
+
+	if err := verifyLicense(license); err != nil {
+		fmt.Printf("failed to verify license: %s\n", err.Error())
 		return -1
 	}
-	license := obj.(*kotsv1beta1.License)
 
 	pullOptions := pull.PullOptions{
-		LicenseFile:         expectedLicenseFile,
-		RootDir:             tmpRoot,
-		ExcludeKotsKinds:    true,
-		ExcludeAdminConsole: true,
-		CreateAppDir:        false,
+		LicenseFile:             expectedLicenseFile,
+		LicensePublicKeyFiles:   licensePublicKeyFiles(),
+		SkipLicenseVerification: skipLicenseVerification(),
+		RootDir:                 tmpRoot,
+		ExcludeKotsKinds:        true,
+		ExcludeAdminConsole:     true,
+		CreateAppDir:            false,
+	}
+
+	// listing the pending releases is much cheaper than pulling, so only pull
+	// when there is something new
+	updates, err := pull.ListUpdates(fmt.Sprintf("replicated://%s", license.Spec.AppSlug), beforeCursor, pullOptions)
+	if err != nil {
+		fmt.Printf("failed to list updates, checking by pulling instead: %s\n", err.Error())
+	} else if len(updates) == 0 {
+		fmt.Printf("Result of checking for updates for %s: no updates after %s\n", license.Spec.AppSlug, beforeCursor)
+		return 0
 	}
 
 	if _, err := pull.Pull(fmt.Sprintf("replicated://%s", license.Spec.AppSlug), pullOptions); err != nil {
@@ -135,4 +152,23 @@ func readCursorFromPath(rootPath string) (string, error) {
 	return installation.Spec.UpdateCursor, nil
 }
 
+// licensePublicKeyFiles returns the public key files listed in KOTS_LICENSE_PUBLIC_KEYS
+func licensePublicKeyFiles() []string {
+	return filepath.SplitList(os.Getenv("KOTS_LICENSE_PUBLIC_KEYS"))
+}
+
+// skipLicenseVerification returns true when KOTS_SKIP_LICENSE_VERIFICATION is set to
+// true, to trust licenses without a public key to verify them with
+func skipLicenseVerification() bool {
+	return os.Getenv("KOTS_SKIP_LICENSE_VERIFICATION") == "true"
+}
+
+func verifyLicense(license *kotsv1beta1.License) error {
+	if skipLicenseVerification() {
+		return nil
+	}
+
+	return kotslicense.VerifyWithPublicKeyFiles(license, licensePublicKeyFiles())
+}
+
 func main() {}
@@ -9,22 +9,22 @@ import (
 	"path"
 
 	"github.com/mholt/archiver"
-	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
-	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	kotslicense "github.com/replicatedhq/kots/pkg/license"
 	"github.com/replicatedhq/kots/pkg/pull"
-	"k8s.io/client-go/kubernetes/scheme"
 )
 
 //export PullFromLicense
 func PullFromLicense(licenseData string, downstream string, outputFile string) int {
-	kotsscheme.AddToScheme(scheme.Scheme)
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	obj, _, err := decode([]byte(licenseData), nil, nil)
+	license, err := kotslicense.ParseLicense([]byte(licenseData))
 	if err != nil {
-		fmt.Printf("failed to decode license data: %s\n", err.Error())
+		fmt.Printf("failed to parse license: %s\n", err.Error())
+		return 1
+	}
+
+	if err := verifyLicense(license); err != nil {
+		fmt.Printf("failed to verify license: %s\n", err.Error())
 		return 1
 	}
-	license := obj.(*kotsv1beta1.License)
 
 	licenseFile, err := ioutil.TempFile("", "kots")
 	if err != nil {
@@ -47,12 +47,14 @@ func PullFromLicense(licenseData string, downstream string, outputFile string) i
 	defer os.RemoveAll(tmpRoot)
 
 	pullOptions := pull.PullOptions{
-		Downstreams:         []string{downstream},
-		LicenseFile:         licenseFile.Name(),
-		ExcludeKotsKinds:    true,
-		RootDir:             tmpRoot,
-		ExcludeAdminConsole: true,
-		CreateAppDir:        false,
+		Downstreams:             []string{downstream},
+		LicenseFile:             licenseFile.Name(),
+		LicensePublicKeyFiles:   licensePublicKeyFiles(),
+		SkipLicenseVerification: skipLicenseVerification(),
+		ExcludeKotsKinds:        true,
+		RootDir:                 tmpRoot,
+		ExcludeAdminConsole:     true,
+		CreateAppDir:            false,
 	}
 
 	if _, err := pull.Pull(fmt.Sprintf("replicated://%s", license.Spec.AppSlug), pullOptions); err != nil {
@@ -22,8 +22,14 @@ import (
 
 // InstallationSpec defines the desired state of InstallationSpec
 type InstallationSpec struct {
-	UpdateCursor string `json:"updateCursor,omitEmpty"`
-	VersionLabel string `json:"versionLabel,omitEmpty"`
+	UpdateCursor string       `json:"updateCursor,omitEmpty"`
+	VersionLabel string       `json:"versionLabel,omitEmpty"`
+	ReleaseNotes string       `json:"releaseNotes,omitempty"`
+	ReleasedAt   *metav1.Time `json:"releasedAt,omitempty"`
+	ChannelName  string       `json:"channelName,omitempty"`
+	UpstreamURI  string       `json:"upstreamURI,omitempty"`
+	KubeVersion  string       `json:"kubeVersion,omitempty"`
+	APIVersions  []string     `json:"apiVersions,omitempty"`
 }
 
 // InstallationStatus defines the observed state of Installation
@@ -0,0 +1,362 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxFiles is the most files that an archive can have when Options.MaxFiles
+	// is not set
+	DefaultMaxFiles = 10000
+
+	// DefaultMaxSize is the most bytes that the files in an archive can add up to when
+	// Options.MaxSize is not set
+	DefaultMaxSize = 512 * 1024 * 1024
+)
+
+// Options limits what will be read from an archive. Zero values use the defaults.
+type Options struct {
+	MaxFiles int
+	MaxSize  int64
+}
+
+// File is a regular file that was read from an archive
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// ErrUnsafePath is returned for an entry that would be written outside of the
+// directory that the archive is extracted to
+type ErrUnsafePath struct {
+	Name string
+}
+
+func (e ErrUnsafePath) Error() string {
+	return fmt.Sprintf("archive entry %q is outside of the archive root", e.Name)
+}
+
+// ErrUnsupportedEntry is returned for an entry that is not a regular file or a
+// directory, such as a symlink or a device
+type ErrUnsupportedEntry struct {
+	Name     string
+	Typeflag byte
+}
+
+func (e ErrUnsupportedEntry) Error() string {
+	return fmt.Sprintf("archive entry %q has unsupported type %q", e.Name, string(e.Typeflag))
+}
+
+// ErrTooManyFiles is returned when an archive has more files than allowed
+type ErrTooManyFiles struct {
+	MaxFiles int
+}
+
+func (e ErrTooManyFiles) Error() string {
+	return fmt.Sprintf("archive has more than %d files", e.MaxFiles)
+}
+
+// ErrTooLarge is returned when the files in an archive add up to more than allowed
+type ErrTooLarge struct {
+	MaxSize int64
+}
+
+func (e ErrTooLarge) Error() string {
+	return fmt.Sprintf("archive is larger than %d bytes", e.MaxSize)
+}
+
+// ReadTarGz returns the regular files in a gzipped tar archive
+func ReadTarGz(r io.Reader, options Options) ([]File, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create gzip reader")
+	}
+	defer gzr.Close()
+
+	return ReadTar(gzr, options)
+}
+
+// ReadTar returns the regular files in a tar archive
+func ReadTar(r io.Reader, options Options) ([]File, error) {
+	files := []File{}
+
+	err := walkTar(r, options, func(name string, header *tar.Header, content io.Reader) error {
+		if header.Typeflag == tar.TypeDir {
+			return nil
+		}
+
+		b, err := ioutil.ReadAll(content)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, File{
+			Path:    name,
+			Content: b,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ExtractTarGzFile extracts the gzipped tar archive file into destDir
+func ExtractTarGzFile(filename string, destDir string, options Options) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to open archive")
+	}
+	defer f.Close()
+
+	return ExtractTarGz(f, destDir, options)
+}
+
+// ExtractTarGz extracts a gzipped tar archive into destDir, which is created if it
+// doesn't exist. Nothing is ever written outside of destDir.
+func ExtractTarGz(r io.Reader, destDir string, options Options) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create dest dir")
+	}
+
+	return walkTarGz(r, options, func(name string, header *tar.Header, content io.Reader) error {
+		destPath := filepath.Join(destDir, filepath.FromSlash(name))
+
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				return errors.Wrapf(err, "failed to create dir %s", name)
+			}
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return errors.Wrapf(err, "failed to create dir for %s", name)
+		}
+
+		// only the permission bits are kept, and files are never writable by others
+		mode := header.FileInfo().Mode().Perm()&0755 | 0600
+		f, err := os.OpenFile(destPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create file %s", name)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(f, content); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ReadZip returns the regular files in a zip archive, with the same checks as tar
+// archives. Symlinks and other special files are not supported.
+func ReadZip(content []byte, options Options) ([]File, error) {
+	maxFiles, maxSize := options.limits()
+
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create zip reader")
+	}
+
+	files := []File{}
+	remainingSize := maxSize
+	for _, zipFile := range zipReader.File {
+		mode := zipFile.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			return nil, ErrUnsupportedEntry{Name: zipFile.Name, Typeflag: zipEntryTypeflag(mode)}
+		}
+
+		name, err := cleanEntryName(zipFile.Name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+
+		if len(files) >= maxFiles {
+			return nil, ErrTooManyFiles{MaxFiles: maxFiles}
+		}
+
+		r, err := zipFile.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %s in zip archive", name)
+		}
+		b, err := ioutil.ReadAll(&limitedReader{
+			r:         r,
+			remaining: &remainingSize,
+			maxSize:   maxSize,
+		})
+		r.Close()
+		if err != nil {
+			if _, ok := err.(ErrTooLarge); ok {
+				return nil, err
+			}
+			return nil, errors.Wrapf(err, "failed to read %s from zip archive", name)
+		}
+
+		files = append(files, File{
+			Path:    name,
+			Content: b,
+		})
+	}
+
+	return files, nil
+}
+
+// zipEntryTypeflag returns the tar type of a zip entry that isn't a regular file or
+// a directory, for errors
+func zipEntryTypeflag(mode os.FileMode) byte {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return tar.TypeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return tar.TypeFifo
+	case mode&os.ModeCharDevice != 0:
+		return tar.TypeChar
+	default:
+		return tar.TypeBlock
+	}
+}
+
+func (o Options) limits() (int, int64) {
+	maxFiles := o.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	maxSize := o.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	return maxFiles, maxSize
+}
+
+// walkTarGz calls fn with each regular file and directory in the gzipped archive
+func walkTarGz(r io.Reader, options Options, fn func(name string, header *tar.Header, content io.Reader) error) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to create gzip reader")
+	}
+	defer gzr.Close()
+
+	return walkTar(gzr, options, fn)
+}
+
+// walkTar calls fn with each regular file and directory in the archive, with the
+// cleaned slash separated name of the entry. The content reader returns an error
+// once the archive is larger than allowed.
+func walkTar(r io.Reader, options Options, fn func(name string, header *tar.Header, content io.Reader) error) error {
+	maxFiles, maxSize := options.limits()
+
+	tarReader := tar.NewReader(r)
+
+	numFiles := 0
+	remainingSize := maxSize
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read tar archive")
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeDir:
+		case tar.TypeXGlobalHeader:
+			// pax global headers (git archive writes one) are metadata, not files
+			continue
+		default:
+			return ErrUnsupportedEntry{Name: header.Name, Typeflag: header.Typeflag}
+		}
+
+		name, err := cleanEntryName(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+
+		if header.Typeflag != tar.TypeDir {
+			numFiles++
+			if numFiles > maxFiles {
+				return ErrTooManyFiles{MaxFiles: maxFiles}
+			}
+		}
+
+		content := &limitedReader{
+			r:         tarReader,
+			remaining: &remainingSize,
+			maxSize:   maxSize,
+		}
+		if err := fn(name, header, content); err != nil {
+			if _, ok := errors.Cause(err).(ErrTooLarge); ok {
+				return errors.Cause(err)
+			}
+			return errors.Wrapf(err, "failed to read %s from tar archive", name)
+		}
+	}
+
+	return nil
+}
+
+// cleanEntryName returns the entry name relative to the archive root, or an error
+// if the entry is absolute or escapes the root. An empty name is the root itself.
+func cleanEntryName(name string) (string, error) {
+	slashName := strings.Replace(name, "\\", "/", -1)
+	if path.IsAbs(slashName) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", ErrUnsafePath{Name: name}
+	}
+
+	cleaned := path.Clean(slashName)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrUnsafePath{Name: name}
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+
+	return cleaned, nil
+}
+
+// limitedReader fails once more than the remaining bytes, which are shared by all of
+// the files in an archive, have been read
+type limitedReader struct {
+	r         io.Reader
+	remaining *int64
+	maxSize   int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > *l.remaining+1 {
+		p = p[:*l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	*l.remaining -= int64(n)
+	if *l.remaining < 0 {
+		return n, ErrTooLarge{MaxSize: l.maxSize}
+	}
+
+	return n, err
+}
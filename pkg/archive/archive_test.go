@@ -0,0 +1,337 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func Test_ReadTarGz(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []testEntry
+		options     Options
+		expectFiles []File
+		expectErr   error
+	}{
+		{
+			name: "regular files and dirs",
+			entries: []testEntry{
+				{name: "app/", typeflag: tar.TypeDir},
+				{name: "app/a.yaml", content: "a"},
+				{name: "./app/b/b.yaml", content: "b"},
+			},
+			expectFiles: []File{
+				{Path: "app/a.yaml", Content: []byte("a")},
+				{Path: "app/b/b.yaml", Content: []byte("b")},
+			},
+		},
+		{
+			name: "dot dot that stays in the root",
+			entries: []testEntry{
+				{name: "app/../a.yaml", content: "a"},
+			},
+			expectFiles: []File{
+				{Path: "a.yaml", Content: []byte("a")},
+			},
+		},
+		{
+			name: "pax global header",
+			entries: []testEntry{
+				{name: "pax_global_header", typeflag: tar.TypeXGlobalHeader},
+				{name: "a.yaml", content: "a"},
+			},
+			expectFiles: []File{
+				{Path: "a.yaml", Content: []byte("a")},
+			},
+		},
+		{
+			name: "path traversal",
+			entries: []testEntry{
+				{name: "app/../../a.yaml", content: "a"},
+			},
+			expectErr: ErrUnsafePath{Name: "app/../../a.yaml"},
+		},
+		{
+			name: "absolute path",
+			entries: []testEntry{
+				{name: "/etc/passwd", content: "a"},
+			},
+			expectErr: ErrUnsafePath{Name: "/etc/passwd"},
+		},
+		{
+			name: "symlink",
+			entries: []testEntry{
+				{name: "a.yaml", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+			},
+			expectErr: ErrUnsupportedEntry{Name: "a.yaml", Typeflag: tar.TypeSymlink},
+		},
+		{
+			name: "hardlink",
+			entries: []testEntry{
+				{name: "a.yaml", typeflag: tar.TypeLink, linkname: "/etc/passwd"},
+			},
+			expectErr: ErrUnsupportedEntry{Name: "a.yaml", Typeflag: tar.TypeLink},
+		},
+		{
+			name: "too many files",
+			entries: []testEntry{
+				{name: "a.yaml", content: "a"},
+				{name: "b/", typeflag: tar.TypeDir},
+				{name: "b/b.yaml", content: "b"},
+				{name: "c.yaml", content: "c"},
+			},
+			options:   Options{MaxFiles: 2},
+			expectErr: ErrTooManyFiles{MaxFiles: 2},
+		},
+		{
+			name: "too large",
+			entries: []testEntry{
+				{name: "a.yaml", content: "aaaa"},
+				{name: "b.yaml", content: "bbbb"},
+			},
+			options:   Options{MaxSize: 6},
+			expectErr: ErrTooLarge{MaxSize: 6},
+		},
+		{
+			name: "exactly the max size",
+			entries: []testEntry{
+				{name: "a.yaml", content: "aaa"},
+				{name: "b.yaml", content: "bbb"},
+			},
+			options: Options{MaxSize: 6},
+			expectFiles: []File{
+				{Path: "a.yaml", Content: []byte("aaa")},
+				{Path: "b.yaml", Content: []byte("bbb")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			files, err := ReadTarGz(bytes.NewReader(mustTarGz(test.entries)), test.options)
+			if test.expectErr != nil {
+				req.Error(err)
+				assert.Equal(t, test.expectErr, errors.Cause(err))
+				return
+			}
+			req.NoError(err)
+
+			assert.Equal(t, test.expectFiles, files)
+		})
+	}
+}
+
+func Test_ExtractTarGz(t *testing.T) {
+	req := require.New(t)
+
+	tmpDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	destDir := filepath.Join(tmpDir, "dest")
+
+	archive := mustTarGz([]testEntry{
+		{name: "app/", typeflag: tar.TypeDir},
+		{name: "app/a.yaml", content: "a"},
+		{name: "app/b/b.yaml", content: "b"},
+	})
+	err = ExtractTarGz(bytes.NewReader(archive), destDir, Options{})
+	req.NoError(err)
+
+	content, err := ioutil.ReadFile(filepath.Join(destDir, "app", "b", "b.yaml"))
+	req.NoError(err)
+	assert.Equal(t, "b", string(content))
+
+	archive = mustTarGz([]testEntry{
+		{name: "../escaped.yaml", content: "a"},
+	})
+	err = ExtractTarGz(bytes.NewReader(archive), destDir, Options{})
+	assert.Equal(t, ErrUnsafePath{Name: "../escaped.yaml"}, errors.Cause(err))
+
+	_, err = os.Stat(filepath.Join(tmpDir, "escaped.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_ReadZip(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []testEntry
+		options     Options
+		expectFiles []File
+		expectErr   error
+	}{
+		{
+			name: "regular files and dirs",
+			entries: []testEntry{
+				{name: "app/", typeflag: tar.TypeDir},
+				{name: "app/a.yaml", content: "a"},
+				{name: "./app/b/b.yaml", content: "b"},
+			},
+			expectFiles: []File{
+				{Path: "app/a.yaml", Content: []byte("a")},
+				{Path: "app/b/b.yaml", Content: []byte("b")},
+			},
+		},
+		{
+			name: "dot dot that escapes the root",
+			entries: []testEntry{
+				{name: "../../escaped.yaml", content: "a"},
+			},
+			expectErr: ErrUnsafePath{Name: "../../escaped.yaml"},
+		},
+		{
+			name: "absolute path",
+			entries: []testEntry{
+				{name: "/etc/passwd", content: "a"},
+			},
+			expectErr: ErrUnsafePath{Name: "/etc/passwd"},
+		},
+		{
+			name: "symlink",
+			entries: []testEntry{
+				{name: "link", typeflag: tar.TypeSymlink, content: "/etc/passwd"},
+			},
+			expectErr: ErrUnsupportedEntry{Name: "link", Typeflag: tar.TypeSymlink},
+		},
+		{
+			name: "too many files",
+			entries: []testEntry{
+				{name: "a.yaml", content: "a"},
+				{name: "b.yaml", content: "b"},
+				{name: "c.yaml", content: "c"},
+			},
+			options:   Options{MaxFiles: 2},
+			expectErr: ErrTooManyFiles{MaxFiles: 2},
+		},
+		{
+			name: "too large",
+			entries: []testEntry{
+				{name: "a.yaml", content: "abcd"},
+				{name: "b.yaml", content: "efgh"},
+			},
+			options:   Options{MaxSize: 6},
+			expectErr: ErrTooLarge{MaxSize: 6},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := ReadZip(mustZip(test.entries), test.options)
+			if test.expectErr != nil {
+				assert.Equal(t, test.expectErr, errors.Cause(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectFiles, files)
+		})
+	}
+}
+
+func Test_ReadTar(t *testing.T) {
+	var b bytes.Buffer
+	gzr, err := gzip.NewReader(bytes.NewReader(mustTarGz([]testEntry{{name: "app/a.yaml", content: "a"}})))
+	require.NoError(t, err)
+	_, err = b.ReadFrom(gzr)
+	require.NoError(t, err)
+
+	files, err := ReadTar(&b, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []File{{Path: "app/a.yaml", Content: []byte("a")}}, files)
+}
+
+func mustZip(entries []testEntry) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name}
+		switch entry.typeflag {
+		case tar.TypeDir:
+			header.SetMode(os.ModeDir | 0755)
+		case tar.TypeSymlink:
+			header.SetMode(os.ModeSymlink | 0777)
+		default:
+			header.SetMode(0644)
+		}
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+
+	return b.Bytes()
+}
+
+func mustTarGz(entries []testEntry) []byte {
+	var b bytes.Buffer
+	gzw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gzw)
+
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: typeflag,
+			Linkname: entry.linkname,
+			Mode:     0644,
+		}
+		if typeflag == tar.TypeReg {
+			header.Size = int64(len(entry.content))
+		}
+		if typeflag == tar.TypeXGlobalHeader {
+			header = &tar.Header{
+				Typeflag:   typeflag,
+				PAXRecords: map[string]string{"comment": "abc"},
+			}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			panic(err)
+		}
+		if typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(entry.content)); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		panic(err)
+	}
+	if err := gzw.Close(); err != nil {
+		panic(err)
+	}
+
+	return b.Bytes()
+}
@@ -6,6 +6,10 @@ import (
 
 type Base struct {
 	Files []BaseFile
+
+	// Hooks are the pre-install and pre-upgrade hooks of a helm chart. They are
+	// written to HooksDir with their own kustomization, to be applied before the base.
+	Hooks []BaseFile
 }
 
 type BaseFile struct {
@@ -1,20 +1,30 @@
 package base
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/kots/pkg/upstream"
 	"github.com/replicatedhq/kots/pkg/util"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/renderutil"
 	"k8s.io/helm/pkg/timeconv"
+	tversion "k8s.io/helm/pkg/version"
 )
 
+// DefaultKubeVersion is the kubernetes version that helm charts are rendered for when
+// none is set in the render options
+const DefaultKubeVersion = "1.16.0"
+
 func renderHelm(u *upstream.Upstream, renderOptions *RenderOptions) (*Base, error) {
 	chartPath, err := ioutil.TempDir("", "kots")
 	if err != nil {
@@ -23,6 +33,11 @@ func renderHelm(u *upstream.Upstream, renderOptions *RenderOptions) (*Base, erro
 	defer os.RemoveAll(chartPath)
 
 	for _, file := range u.Files {
+		// userdata is written with the upstream, it's not part of the chart
+		if strings.HasPrefix(file.Path, "userdata/") {
+			continue
+		}
+
 		p := path.Join(chartPath, file.Path)
 		d, _ := path.Split(p)
 		if _, err := os.Stat(d); err != nil {
@@ -40,68 +55,158 @@ func renderHelm(u *upstream.Upstream, renderOptions *RenderOptions) (*Base, erro
 		}
 	}
 
-	config := &chart.Config{Raw: string(""), Values: map[string]*chart.Value{}}
+	chartfile, err := prepareChartDir(chartPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare chart")
+	}
+	if chartfile.Type == "library" {
+		return nil, errors.New("library charts are not installable")
+	}
+
+	config := &chart.Config{Raw: string(renderOptions.HelmValues), Values: map[string]*chart.Value{}}
 
 	c, err := chartutil.Load(chartPath)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load chart")
 	}
 
-	renderOpts := renderutil.Options{
-		ReleaseOptions: chartutil.ReleaseOptions{
-			Name:      u.Name,
-			IsInstall: true,
-			IsUpgrade: false,
-			Time:      timeconv.Now(),
-			Namespace: renderOptions.Namespace,
-		},
-		KubeVersion: "1.16.0",
+	releaseOptions := chartutil.ReleaseOptions{
+		Name:      u.Name,
+		IsInstall: true,
+		IsUpgrade: false,
+		Time:      timeconv.Now(),
+		Namespace: renderOptions.Namespace,
+	}
+
+	caps, err := helmCapabilities(renderOptions.KubeVersion, renderOptions.APIVersions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get capabilities")
 	}
 
-	rendered, err := renderutil.Render(c, config, renderOpts)
+	rendered, err := renderChart(c, config, releaseOptions, caps)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to render chart")
 	}
 
 	baseFiles := []BaseFile{}
+	hookFiles := []BaseFile{}
 	for k, v := range rendered {
-		baseFile := BaseFile{
-			Path:    k,
-			Content: []byte(v),
+		baseContent, hookContent := splitHelmHooks([]byte(v), renderOptions.IncludeHelmTests)
+		if baseContent != nil {
+			baseFiles = append(baseFiles, BaseFile{
+				Path:    k,
+				Content: baseContent,
+			})
+		}
+		if hookContent != nil {
+			hookFiles = append(hookFiles, BaseFile{
+				Path:    k,
+				Content: hookContent,
+			})
 		}
+	}
+
+	// the rendered templates are in a map, sort them so that the base is the same
+	// every time the chart is rendered
+	sort.Slice(baseFiles, func(i, j int) bool { return baseFiles[i].Path < baseFiles[j].Path })
+	sort.Slice(hookFiles, func(i, j int) bool { return hookFiles[i].Path < hookFiles[j].Path })
 
-		baseFiles = append(baseFiles, baseFile)
+	// crds are installed by helm 3 without being rendered, they are part of the base
+	if c.GetMetadata().GetApiVersion() == ChartAPIVersionV2 {
+		baseFiles = append(baseFiles, chartCRDs(c, "")...)
 	}
 
 	// remove any common prefix from all files
-	if len(baseFiles) > 0 {
-		firstFileDir, _ := path.Split(baseFiles[0].Path)
-		commonPrefix := strings.Split(firstFileDir, string(os.PathSeparator))
+	allFiles := removeCommonPrefix(append(baseFiles, hookFiles...))
 
-		for _, file := range baseFiles {
-			d, _ := path.Split(file.Path)
-			dirs := strings.Split(d, string(os.PathSeparator))
+	return &Base{
+		Files: allFiles[:len(baseFiles)],
+		Hooks: allFiles[len(baseFiles):],
+	}, nil
+}
 
-			commonPrefix = util.CommonSlicePrefix(commonPrefix, dirs)
+func removeCommonPrefix(baseFiles []BaseFile) []BaseFile {
+	if len(baseFiles) == 0 {
+		return baseFiles
+	}
 
-		}
+	firstFileDir, _ := path.Split(baseFiles[0].Path)
+	commonPrefix := strings.Split(firstFileDir, string(os.PathSeparator))
 
-		cleanedBaseFiles := []BaseFile{}
-		for _, file := range baseFiles {
-			d, f := path.Split(file.Path)
-			d2 := strings.Split(d, string(os.PathSeparator))
+	for _, file := range baseFiles {
+		d, _ := path.Split(file.Path)
+		dirs := strings.Split(d, string(os.PathSeparator))
 
-			cleanedBaseFile := file
-			d2 = d2[len(commonPrefix):]
-			cleanedBaseFile.Path = path.Join(path.Join(d2...), f)
+		commonPrefix = util.CommonSlicePrefix(commonPrefix, dirs)
 
-			cleanedBaseFiles = append(cleanedBaseFiles, cleanedBaseFile)
-		}
+	}
+
+	cleanedBaseFiles := []BaseFile{}
+	for _, file := range baseFiles {
+		d, f := path.Split(file.Path)
+		d2 := strings.Split(d, string(os.PathSeparator))
+
+		cleanedBaseFile := file
+		d2 = d2[len(commonPrefix):]
+		cleanedBaseFile.Path = path.Join(path.Join(d2...), f)
 
-		baseFiles = cleanedBaseFiles
+		cleanedBaseFiles = append(cleanedBaseFiles, cleanedBaseFile)
 	}
 
-	return &Base{
-		Files: baseFiles,
+	return cleanedBaseFiles
+}
+
+// helmCapabilities returns the capabilities that charts are rendered with. The core
+// v1 api is always included, like it is by helm.
+func helmCapabilities(kubeVersion string, apiVersions []string) (*chartutil.Capabilities, error) {
+	if kubeVersion == "" {
+		kubeVersion = DefaultKubeVersion
+	}
+
+	kv, err := semver.NewVersion(kubeVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse kubernetes version %q", kubeVersion)
+	}
+
+	return &chartutil.Capabilities{
+		APIVersions: chartutil.NewVersionSet(append([]string{"v1"}, apiVersions...)...),
+		KubeVersion: &version.Info{
+			Major:      fmt.Sprint(kv.Major()),
+			Minor:      fmt.Sprint(kv.Minor()),
+			GitVersion: fmt.Sprintf("v%d.%d.%d", kv.Major(), kv.Minor(), kv.Patch()),
+		},
+		TillerVersion: tversion.GetVersionProto(),
 	}, nil
 }
+
+// renderChart is renderutil.Render, with capabilities that include api versions.
+// apiVersion v2 charts are rendered with the release service that helm 3 uses.
+func renderChart(c *chart.Chart, config *chart.Config, releaseOptions chartutil.ReleaseOptions, caps *chartutil.Capabilities) (map[string]string, error) {
+	if req, err := chartutil.LoadRequirements(c); err == nil {
+		if err := renderutil.CheckDependencies(c, req); err != nil {
+			return nil, errors.Wrap(err, "failed to check dependencies")
+		}
+	} else if err != chartutil.ErrRequirementsNotFound {
+		return nil, errors.Wrap(err, "failed to load requirements")
+	}
+
+	if err := chartutil.ProcessRequirementsEnabled(c, config); err != nil {
+		return nil, errors.Wrap(err, "failed to process enabled requirements")
+	}
+	if err := chartutil.ProcessRequirementsImportValues(c); err != nil {
+		return nil, errors.Wrap(err, "failed to process requirements import values")
+	}
+
+	vals, err := chartutil.ToRenderValuesCaps(c, config, releaseOptions, caps)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get render values")
+	}
+
+	if c.GetMetadata().GetApiVersion() == ChartAPIVersionV2 {
+		if release, ok := vals["Release"].(map[string]interface{}); ok {
+			release["Service"] = "Helm"
+		}
+	}
+
+	return engine.New().Render(c, vals)
+}
@@ -0,0 +1,192 @@
+package base
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	helmHookAnnotation             = "helm.sh/hook"
+	helmHookDeletePolicyAnnotation = "helm.sh/hook-delete-policy"
+)
+
+// HooksDir is the dir in the base that pre-install and pre-upgrade helm hooks are
+// written to, with a kustomization that can be applied before the base
+const HooksDir = "hooks"
+
+// helmHookPhase is when a rendered resource is created. kots doesn't have a release
+// lifecycle, so hooks are placed by when helm would have created them.
+type helmHookPhase int
+
+const (
+	// helmHookPhaseBase is a resource that is not a hook, or a hook that runs after
+	// an install or upgrade, and is applied with the base
+	helmHookPhaseBase helmHookPhase = iota
+
+	// helmHookPhasePre is a hook that runs before an install or upgrade, or a crd
+	helmHookPhasePre
+
+	// helmHookPhaseTest is a hook that is run by helm test
+	helmHookPhaseTest
+
+	// helmHookPhaseIgnored is a hook that only runs on delete or rollback
+	helmHookPhaseIgnored
+)
+
+type helmHookMetadata struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+func getHelmHookPhase(hooks string) helmHookPhase {
+	if strings.TrimSpace(hooks) == "" {
+		return helmHookPhaseBase
+	}
+
+	isPre, isPost, isTest := false, false, false
+	for _, hook := range strings.Split(hooks, ",") {
+		switch strings.TrimSpace(hook) {
+		case "pre-install", "pre-upgrade", "crd-install":
+			isPre = true
+		case "post-install", "post-upgrade":
+			isPost = true
+		case "test", "test-success", "test-failure":
+			isTest = true
+		}
+	}
+
+	switch {
+	case isPre:
+		return helmHookPhasePre
+	case isPost:
+		return helmHookPhaseBase
+	case isTest:
+		return helmHookPhaseTest
+	default:
+		return helmHookPhaseIgnored
+	}
+}
+
+// splitHelmHooks separates the documents in a rendered template into the documents
+// that belong in the base and the pre-install and pre-upgrade hooks. Test hooks are
+// dropped unless includeTests is set, in which case they are part of the base.
+// Content without any hooks is returned as the base unchanged.
+func splitHelmHooks(content []byte, includeTests bool) ([]byte, []byte) {
+	baseDocs := [][]byte{}
+	hookDocs := [][]byte{}
+	changed := false
+
+	for _, doc := range splitYAMLDocs(content) {
+		metadata := helmHookMetadata{}
+		if err := yaml.Unmarshal(doc, &metadata); err != nil {
+			// not a valid resource, leave it for the base to filter out
+			baseDocs = append(baseDocs, doc)
+			continue
+		}
+
+		annotations := metadata.Metadata.Annotations
+		phase := getHelmHookPhase(annotations[helmHookAnnotation])
+		if phase == helmHookPhaseTest && includeTests {
+			phase = helmHookPhaseBase
+		}
+
+		translated := doc
+		if annotations[helmHookAnnotation] != "" {
+			translated = translateHookDeletePolicy(metadata, translated)
+			if !bytes.Equal(translated, doc) {
+				changed = true
+			}
+		}
+
+		switch phase {
+		case helmHookPhaseBase:
+			baseDocs = append(baseDocs, translated)
+		case helmHookPhasePre:
+			hookDocs = append(hookDocs, translated)
+			changed = true
+		default:
+			changed = true
+		}
+	}
+
+	if !changed {
+		return content, nil
+	}
+
+	return joinYAMLDocs(baseDocs), joinYAMLDocs(hookDocs)
+}
+
+// translateHookDeletePolicy converts the helm hook delete policy of a Job to a ttl,
+// so that the job is removed after it finishes and is created again by the next
+// apply. That's only right for upgrade hooks, which helm runs on every upgrade.
+// An install-only hook keeps its finished job, so applying again doesn't rerun it.
+// The ttl removes jobs that failed as well, so it's only set for hooks that helm
+// would delete when they succeed. before-hook-creation has no equivalent, the
+// annotation is left for reference.
+func translateHookDeletePolicy(metadata helmHookMetadata, doc []byte) []byte {
+	if metadata.Kind != "Job" || !strings.HasPrefix(metadata.APIVersion, "batch/") {
+		return doc
+	}
+
+	if !isUpgradeHook(metadata.Metadata.Annotations[helmHookAnnotation]) {
+		return doc
+	}
+
+	deleteOnSuccess := false
+	for _, policy := range strings.Split(metadata.Metadata.Annotations[helmHookDeletePolicyAnnotation], ",") {
+		if strings.TrimSpace(policy) == "hook-succeeded" {
+			deleteOnSuccess = true
+		}
+	}
+	if !deleteOnSuccess {
+		return doc
+	}
+
+	job := yaml.MapSlice{}
+	if err := yaml.Unmarshal(doc, &job); err != nil {
+		return doc
+	}
+
+	for i, item := range job {
+		if item.Key != "spec" {
+			continue
+		}
+
+		spec, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return doc
+		}
+		for _, specItem := range spec {
+			if specItem.Key == "ttlSecondsAfterFinished" {
+				return doc
+			}
+		}
+
+		job[i].Value = append(spec, yaml.MapItem{Key: "ttlSecondsAfterFinished", Value: 0})
+
+		b, err := yaml.Marshal(job)
+		if err != nil {
+			return doc
+		}
+		return b
+	}
+
+	return doc
+}
+
+// isUpgradeHook returns true if helm runs the hook when a release is upgraded
+func isUpgradeHook(hooks string) bool {
+	for _, hook := range strings.Split(hooks, ",") {
+		switch strings.TrimSpace(hook) {
+		case "pre-upgrade", "post-upgrade":
+			return true
+		}
+	}
+
+	return false
+}
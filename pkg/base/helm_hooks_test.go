@@ -0,0 +1,225 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_splitHelmHooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		includeTests  bool
+		expectedBase  string
+		expectedHooks string
+	}{
+		{
+			name:         "no hooks",
+			content:      "apiVersion: v1\nkind: Service\nmetadata:\n  name: web",
+			expectedBase: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web",
+		},
+		{
+			name: "pre-install hook",
+			content: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: setup
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+`,
+			expectedHooks: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: setup
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+`,
+		},
+		{
+			name: "post-install hook is part of the base",
+			content: `apiVersion: v1
+kind: Pod
+metadata:
+  name: notify
+  annotations:
+    helm.sh/hook: post-install
+`,
+			expectedBase: `apiVersion: v1
+kind: Pod
+metadata:
+  name: notify
+  annotations:
+    helm.sh/hook: post-install
+`,
+		},
+		{
+			name: "test hook is dropped",
+			content: `apiVersion: v1
+kind: Pod
+metadata:
+  name: test-connection
+  annotations:
+    helm.sh/hook: test-success
+`,
+		},
+		{
+			name:         "test hook is included",
+			includeTests: true,
+			content: `apiVersion: v1
+kind: Pod
+metadata:
+  name: test-connection
+  annotations:
+    helm.sh/hook: test-success
+`,
+			expectedBase: `apiVersion: v1
+kind: Pod
+metadata:
+  name: test-connection
+  annotations:
+    helm.sh/hook: test-success
+`,
+		},
+		{
+			name: "delete and rollback hooks are dropped",
+			content: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: cleanup
+  annotations:
+    helm.sh/hook: pre-delete,post-rollback
+`,
+		},
+		{
+			name: "multiple documents",
+			content: `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: setup
+  annotations:
+    helm.sh/hook: crd-install
+`,
+			expectedBase: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+			expectedHooks: `apiVersion: v1
+kind: Secret
+metadata:
+  name: setup
+  annotations:
+    helm.sh/hook: crd-install
+`,
+		},
+		{
+			name: "delete policy is translated to a ttl",
+			content: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-upgrade
+    helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+`,
+			expectedHooks: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-upgrade
+    helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+  ttlSecondsAfterFinished: 0
+`,
+		},
+		{
+			name: "delete policy of an install-only hook is not translated",
+			content: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: seed
+  annotations:
+    helm.sh/hook: post-install
+    helm.sh/hook-delete-policy: hook-succeeded
+spec:
+  backoffLimit: 1
+`,
+			// the finished job is kept so that applying again doesn't rerun it
+			expectedBase: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: seed
+  annotations:
+    helm.sh/hook: post-install
+    helm.sh/hook-delete-policy: hook-succeeded
+spec:
+  backoffLimit: 1
+`,
+		},
+		{
+			name: "delete policy of a post-upgrade hook is translated to a ttl",
+			content: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: notify
+  annotations:
+    helm.sh/hook: post-install,post-upgrade
+    helm.sh/hook-delete-policy: hook-succeeded
+spec:
+  backoffLimit: 1
+`,
+			expectedBase: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: notify
+  annotations:
+    helm.sh/hook: post-install,post-upgrade
+    helm.sh/hook-delete-policy: hook-succeeded
+spec:
+  backoffLimit: 1
+  ttlSecondsAfterFinished: 0
+`,
+		},
+		{
+			name: "before-hook-creation is not translated",
+			content: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+    helm.sh/hook-delete-policy: before-hook-creation
+spec:
+  backoffLimit: 1
+`,
+			expectedHooks: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+    helm.sh/hook-delete-policy: before-hook-creation
+spec:
+  backoffLimit: 1
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base, hooks := splitHelmHooks([]byte(test.content), test.includeTests)
+			assert.Equal(t, test.expectedBase, string(base))
+			assert.Equal(t, test.expectedHooks, string(hooks))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/kots/pkg/upstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_renderHelmValues(t *testing.T) {
+	u := &upstream.Upstream{
+		Name: "redis",
+		Type: "helm",
+		Files: []upstream.UpstreamFile{
+			{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0")},
+			{Path: "values.yaml", Content: []byte("replicas: 1\nimage: redis:5")},
+			{Path: "templates/deployment.yaml", Content: []byte("replicas: {{ .Values.replicas }}\nimage: {{ .Values.image }}")},
+			{Path: upstream.HelmValuesPath, Content: []byte("replicas: 3")},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		helmValues []byte
+		expected   string
+	}{
+		{
+			name:     "chart defaults",
+			expected: "replicas: 1\nimage: redis:5",
+		},
+		{
+			name:       "values override the defaults",
+			helmValues: []byte("replicas: 3"),
+			expected:   "replicas: 3\nimage: redis:5",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			b, err := renderHelm(u, &RenderOptions{Namespace: "default", HelmValues: test.helmValues})
+			req.NoError(err)
+			req.Len(b.Files, 1)
+			assert.Equal(t, "deployment.yaml", b.Files[0].Path)
+			assert.Equal(t, test.expected, string(b.Files[0].Content))
+		})
+	}
+}
+
+func Test_renderHelmCapabilities(t *testing.T) {
+	u := &upstream.Upstream{
+		Name: "app",
+		Type: "helm",
+		Files: []upstream.UpstreamFile{
+			{Path: "Chart.yaml", Content: []byte("name: app\nversion: 1.0.0")},
+			{Path: "templates/ingress.yaml", Content: []byte(`{{ if .Capabilities.APIVersions.Has "networking.k8s.io/v1beta1" }}apiVersion: networking.k8s.io/v1beta1{{ else }}apiVersion: extensions/v1beta1{{ end }}
+kubeVersion: {{ .Capabilities.KubeVersion.Major }}.{{ .Capabilities.KubeVersion.Minor }}`)},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		kubeVersion string
+		apiVersions []string
+		expected    string
+		expectErr   bool
+	}{
+		{
+			name:     "defaults",
+			expected: "apiVersion: extensions/v1beta1\nkubeVersion: 1.16",
+		},
+		{
+			name:        "kube version and api versions",
+			kubeVersion: "v1.14.3",
+			apiVersions: []string{"apps/v1", "networking.k8s.io/v1beta1"},
+			expected:    "apiVersion: networking.k8s.io/v1beta1\nkubeVersion: 1.14",
+		},
+		{
+			name:        "invalid kube version",
+			kubeVersion: "latest",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			b, err := renderHelm(u, &RenderOptions{Namespace: "default", KubeVersion: test.kubeVersion, APIVersions: test.apiVersions})
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			req.Len(b.Files, 1)
+			assert.Equal(t, test.expected, string(b.Files[0].Content))
+		})
+	}
+}
+
+func Test_renderHelmChartAPIVersionV2(t *testing.T) {
+	chartFiles := []upstream.UpstreamFile{
+		{Path: "Chart.yaml", Content: []byte(`apiVersion: v2
+name: app
+version: 1.0.0
+dependencies:
+- name: common
+  version: 1.0.0
+- name: cache
+  version: 1.0.0
+  condition: cache.enabled
+`)},
+		{Path: "values.yaml", Content: []byte("cache:\n  enabled: false")},
+		{Path: "templates/service.yaml", Content: []byte(`{{ include "common.labels" . }}
+service: {{ .Release.Service }}`)},
+		{Path: "crds/widget.yaml", Content: []byte("kind: CustomResourceDefinition")},
+		{Path: "charts/common/Chart.yaml", Content: []byte("apiVersion: v2\nname: common\nversion: 1.0.0\ntype: library")},
+		{Path: "charts/common/templates/labels.yaml", Content: []byte(`{{ define "common.labels" }}app: {{ .Chart.Name }}{{ end }}`)},
+		{Path: "charts/cache/Chart.yaml", Content: []byte("apiVersion: v2\nname: cache\nversion: 1.0.0")},
+		{Path: "charts/cache/templates/deployment.yaml", Content: []byte("kind: Deployment")},
+		{Path: "charts/cache/crds/cache.yaml", Content: []byte("kind: CustomResourceDefinition")},
+	}
+
+	tests := []struct {
+		name       string
+		helmValues []byte
+		expected   map[string]string
+	}{
+		{
+			name: "disabled dependency",
+			expected: map[string]string{
+				"templates/service.yaml": "app: app\nservice: Helm",
+				"crds/widget.yaml":       "kind: CustomResourceDefinition",
+			},
+		},
+		{
+			name:       "enabled dependency",
+			helmValues: []byte("cache:\n  enabled: true"),
+			expected: map[string]string{
+				"templates/service.yaml":                 "app: app\nservice: Helm",
+				"crds/widget.yaml":                       "kind: CustomResourceDefinition",
+				"charts/cache/templates/deployment.yaml": "kind: Deployment",
+				"charts/cache/crds/cache.yaml":           "kind: CustomResourceDefinition",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			u := &upstream.Upstream{Name: "app", Type: "helm", Files: chartFiles}
+			b, err := renderHelm(u, &RenderOptions{Namespace: "default", HelmValues: test.helmValues})
+			req.NoError(err)
+
+			rendered := map[string]string{}
+			for _, file := range b.Files {
+				rendered[file.Path] = string(file.Content)
+			}
+			assert.Equal(t, test.expected, rendered)
+		})
+	}
+}
+
+func Test_renderHelmLibraryChart(t *testing.T) {
+	u := &upstream.Upstream{
+		Name: "common",
+		Type: "helm",
+		Files: []upstream.UpstreamFile{
+			{Path: "Chart.yaml", Content: []byte("apiVersion: v2\nname: common\nversion: 1.0.0\ntype: library")},
+		},
+	}
+
+	_, err := renderHelm(u, &RenderOptions{Namespace: "default"})
+	assert.Error(t, err)
+}
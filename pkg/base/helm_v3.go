@@ -0,0 +1,144 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"sigs.k8s.io/yaml"
+)
+
+// ChartAPIVersionV2 is the chart api version introduced with helm 3
+const ChartAPIVersionV2 = "v2"
+
+// helmChartfile is the part of Chart.yaml that helm 2 doesn't read into the chart
+// metadata
+type helmChartfile struct {
+	APIVersion   string                  `json:"apiVersion"`
+	Type         string                  `json:"type,omitempty"`
+	Dependencies []*chartutil.Dependency `json:"dependencies,omitempty"`
+}
+
+func readHelmChartfile(chartDir string) (*helmChartfile, error) {
+	b, err := ioutil.ReadFile(path.Join(chartDir, "Chart.yaml"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Chart.yaml")
+	}
+
+	chartfile := helmChartfile{}
+	if err := yaml.Unmarshal(b, &chartfile); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal Chart.yaml")
+	}
+
+	return &chartfile, nil
+}
+
+// prepareChartDir converts the apiVersion v2 charts in a chart dir, and all of its
+// subcharts, to charts that the helm 2 loader and renderer handle the same way that
+// helm 3 does. Archived subcharts are expanded so that they can be converted too,
+// dependencies in Chart.yaml are written to requirements.yaml, and templates in
+// library charts are renamed to partials, so that their named templates are defined
+// but nothing is rendered. The chart file of the chart in the dir is returned.
+func prepareChartDir(chartDir string) (*helmChartfile, error) {
+	chartfile, err := readHelmChartfile(chartDir)
+	if err != nil {
+		return nil, err
+	}
+
+	chartsDir := path.Join(chartDir, "charts")
+	archives, err := filepath.Glob(path.Join(chartsDir, "*.tgz"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list subchart archives")
+	}
+	for _, archive := range archives {
+		if err := chartutil.ExpandFile(chartsDir, archive); err != nil {
+			return nil, errors.Wrapf(err, "failed to expand subchart %s", path.Base(archive))
+		}
+		if err := os.Remove(archive); err != nil {
+			return nil, errors.Wrap(err, "failed to remove subchart archive")
+		}
+	}
+
+	if chartfile.APIVersion == ChartAPIVersionV2 {
+		requirementsPath := path.Join(chartDir, "requirements.yaml")
+		if len(chartfile.Dependencies) > 0 {
+			b, err := yaml.Marshal(chartutil.Requirements{Dependencies: chartfile.Dependencies})
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to marshal dependencies")
+			}
+			if err := ioutil.WriteFile(requirementsPath, b, 0644); err != nil {
+				return nil, errors.Wrap(err, "failed to write requirements")
+			}
+		} else if err := os.RemoveAll(requirementsPath); err != nil {
+			// helm 3 ignores requirements.yaml in v2 charts
+			return nil, errors.Wrap(err, "failed to remove requirements")
+		}
+
+		if chartfile.Type == "library" {
+			if err := renameToPartials(path.Join(chartDir, "templates")); err != nil {
+				return nil, errors.Wrap(err, "failed to rename library templates")
+			}
+		}
+	}
+
+	subcharts, err := ioutil.ReadDir(chartsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to list subcharts")
+	}
+	for _, subchart := range subcharts {
+		// the helm loader ignores charts that start with . or _
+		if !subchart.IsDir() || strings.IndexAny(subchart.Name(), "._") == 0 {
+			continue
+		}
+		if _, err := prepareChartDir(path.Join(chartsDir, subchart.Name())); err != nil {
+			return nil, errors.Wrapf(err, "failed to prepare subchart %s", subchart.Name())
+		}
+	}
+
+	return chartfile, nil
+}
+
+func renameToPartials(templatesDir string) error {
+	return filepath.Walk(templatesDir, func(filePath string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), "_") {
+			return nil
+		}
+
+		return os.Rename(filePath, path.Join(path.Dir(filePath), "_"+info.Name()))
+	})
+}
+
+// chartCRDs returns the files in the crds dir of a chart and its enabled subcharts,
+// which helm 3 installs without rendering them. The paths are prefixed the same way
+// that rendered templates are.
+func chartCRDs(c *chart.Chart, prefix string) []BaseFile {
+	chartPrefix := path.Join(prefix, c.GetMetadata().GetName())
+
+	crds := []BaseFile{}
+	for _, file := range c.GetFiles() {
+		if !strings.HasPrefix(file.GetTypeUrl(), "crds/") {
+			continue
+		}
+		crds = append(crds, BaseFile{
+			Path:    path.Join(chartPrefix, file.GetTypeUrl()),
+			Content: file.GetValue(),
+		})
+	}
+
+	for _, dependency := range c.GetDependencies() {
+		crds = append(crds, chartCRDs(dependency, path.Join(chartPrefix, "charts"))...)
+	}
+
+	return crds
+}
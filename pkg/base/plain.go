@@ -0,0 +1,26 @@
+package base
+
+import (
+	"github.com/replicatedhq/kots/pkg/upstream"
+)
+
+// renderPlain creates a base from an upstream of plain kubernetes yaml. There is
+// no templating in these upstreams, so the files are used as-is.
+func renderPlain(u *upstream.Upstream, renderOptions *RenderOptions) (*Base, error) {
+	baseFiles := []BaseFile{}
+
+	for _, upstreamFile := range u.Files {
+		baseFile := BaseFile{
+			Path:    upstreamFile.Path,
+			Content: upstreamFile.Content,
+		}
+
+		baseFiles = append(baseFiles, baseFile)
+	}
+
+	base := Base{
+		Files: baseFiles,
+	}
+
+	return &base, nil
+}
@@ -1,25 +1,77 @@
 package base
 
 import (
+	"sync"
+
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/kots/pkg/upstream"
 )
 
 type RenderOptions struct {
+	// SplitMultiDocYAML writes each document in a multi doc yaml file to its own
+	// file in the base, named by its kind and name
 	SplitMultiDocYAML bool
 	Namespace         string
+
+	// HelmValues is yaml that is coalesced with the chart's values when rendering
+	// helm upstreams
+	HelmValues []byte
+
+	// KubeVersion and APIVersions are the capabilities of the cluster that helm
+	// charts are rendered for. DefaultKubeVersion is used when KubeVersion is not set.
+	KubeVersion string
+	APIVersions []string
+
+	// IncludeHelmTests keeps helm test hooks in the base. They are dropped by default.
+	IncludeHelmTests bool
+}
+
+// Renderer converts an upstream of a single type into a base
+type Renderer func(u *upstream.Upstream, renderOptions *RenderOptions) (*Base, error)
+
+var (
+	renderers   = map[string]Renderer{}
+	renderersMu sync.RWMutex
+)
+
+func init() {
+	RegisterRenderer("helm", renderHelm)
+	RegisterRenderer("replicated", renderReplicated)
+	RegisterRenderer("plain", renderPlain)
+
+	// kustomize upstreams are built when they are fetched, so they are plain yaml
+	RegisterRenderer("kustomize", renderPlain)
+}
+
+// RegisterRenderer makes a renderer available for an upstream type. Upstream providers
+// that return a type other than the built in types should register a renderer for it.
+func RegisterRenderer(upstreamType string, renderer Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+
+	renderers[upstreamType] = renderer
 }
 
 // RenderUpstream is responsible for any conversions or transpilation steps are required
 // to take an upstream and make it a valid kubernetes base
 func RenderUpstream(u *upstream.Upstream, renderOptions *RenderOptions) (*Base, error) {
-	if u.Type == "helm" {
-		return renderHelm(u, renderOptions)
+	renderersMu.RLock()
+	renderer, ok := renderers[u.Type]
+	renderersMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("unknown upstream type %q", u.Type)
+	}
+
+	b, err := renderer(u, renderOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	if u.Type == "replicated" {
-		return renderReplicated(u, renderOptions)
+	if renderOptions.SplitMultiDocYAML {
+		b.Files = splitMultiDocYAML(b.Files)
+		b.Hooks = splitMultiDocYAML(b.Hooks)
 	}
 
-	return nil, errors.New("unknown upstream type")
+	return b, nil
 }
@@ -0,0 +1,111 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	yamlDocSeparator     = regexp.MustCompile(`(?m)^---[ \t]*$`)
+	invalidFilenameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+type splitDocMetadata struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+}
+
+// splitYAMLDocs returns the non-empty documents in a multi doc yaml
+func splitYAMLDocs(content []byte) [][]byte {
+	docs := [][]byte{}
+	for _, doc := range yamlDocSeparator.Split(string(content), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		docs = append(docs, []byte(doc))
+	}
+
+	return docs
+}
+
+func joinYAMLDocs(docs [][]byte) []byte {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	trimmed := [][]byte{}
+	for _, doc := range docs {
+		trimmed = append(trimmed, bytes.Trim(doc, "\n"))
+	}
+
+	return append(bytes.Join(trimmed, []byte("\n---\n")), '\n')
+}
+
+// splitMultiDocYAML splits the files with more than one document into a file per
+// document, so that each document is included in or excluded from the base on its
+// own. The files are written to the same dir as the file they were split from, and
+// are named by the kind and name of the document. Files with a single document are
+// left as they are.
+func splitMultiDocYAML(files []BaseFile) []BaseFile {
+	usedPaths := map[string]bool{}
+	for _, file := range files {
+		usedPaths[file.Path] = true
+	}
+
+	splitFiles := []BaseFile{}
+	for _, file := range files {
+		docs := splitYAMLDocs(file.Content)
+		if len(docs) <= 1 {
+			splitFiles = append(splitFiles, file)
+			continue
+		}
+
+		delete(usedPaths, file.Path)
+
+		dir, filename := path.Split(file.Path)
+		stem := strings.TrimSuffix(filename, path.Ext(filename))
+
+		for i, doc := range docs {
+			docPath := path.Join(dir, uniqueFilename(usedPaths, dir, docFilename(doc, stem, i)))
+			usedPaths[docPath] = true
+
+			splitFiles = append(splitFiles, BaseFile{
+				Path:    docPath,
+				Content: append(bytes.Trim(doc, "\n"), '\n'),
+			})
+		}
+	}
+
+	return splitFiles
+}
+
+// docFilename returns the name of a file for a document, without an extension. Documents
+// without a kind and name are named by the file they were split from and their index.
+func docFilename(doc []byte, stem string, index int) string {
+	metadata := splitDocMetadata{}
+	if err := yaml.Unmarshal(doc, &metadata); err == nil && metadata.Kind != "" && metadata.Metadata.Name != "" {
+		return sanitizeFilename(fmt.Sprintf("%s-%s", metadata.Kind, metadata.Metadata.Name))
+	}
+
+	return sanitizeFilename(fmt.Sprintf("%s-%d", stem, index+1))
+}
+
+func sanitizeFilename(name string) string {
+	return strings.Trim(invalidFilenameChars.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+}
+
+func uniqueFilename(usedPaths map[string]bool, dir string, name string) string {
+	filename := name + ".yaml"
+	for i := 2; usedPaths[path.Join(dir, filename)]; i++ {
+		filename = fmt.Sprintf("%s-%d.yaml", name, i)
+	}
+
+	return filename
+}
@@ -0,0 +1,100 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_splitMultiDocYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []BaseFile
+		expected []BaseFile
+	}{
+		{
+			name: "single document",
+			files: []BaseFile{
+				{Path: "deployment.yaml", Content: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web")},
+			},
+			expected: []BaseFile{
+				{Path: "deployment.yaml", Content: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web")},
+			},
+		},
+		{
+			name: "documents are named by kind and name",
+			files: []BaseFile{
+				{Path: "manifests/app.yaml", Content: []byte(`---
+apiVersion: kots.io/v1beta1
+kind: Config
+metadata:
+  name: app-config
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`)},
+			},
+			expected: []BaseFile{
+				{Path: "manifests/config-app-config.yaml", Content: []byte("apiVersion: kots.io/v1beta1\nkind: Config\nmetadata:\n  name: app-config\n")},
+				{Path: "manifests/deployment-web.yaml", Content: []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n")},
+			},
+		},
+		{
+			name: "duplicate and unnamed documents",
+			files: []BaseFile{
+				{Path: "service-web.yaml", Content: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web")},
+				{Path: "kustomize-build.yaml", Content: []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: other
+---
+# a comment
+data: {}
+`)},
+			},
+			expected: []BaseFile{
+				{Path: "service-web.yaml", Content: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web")},
+				{Path: "service-web-2.yaml", Content: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n")},
+				{Path: "service-web-3.yaml", Content: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  namespace: other\n")},
+				{Path: "kustomize-build-3.yaml", Content: []byte("# a comment\ndata: {}\n")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, splitMultiDocYAML(test.files))
+		})
+	}
+}
+
+func Test_splitMultiDocYAMLExcludeKotsKinds(t *testing.T) {
+	files := splitMultiDocYAML([]BaseFile{
+		{Path: "app.yaml", Content: []byte(`apiVersion: kots.io/v1beta1
+kind: Config
+metadata:
+  name: app-config
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`)},
+	})
+
+	included := []string{}
+	for _, file := range files {
+		if file.ShouldBeIncludedInBaseKustomization(true) {
+			included = append(included, file.Path)
+		}
+	}
+	assert.Equal(t, []string{"deployment-web.yaml"}, included)
+}
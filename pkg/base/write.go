@@ -31,10 +31,24 @@ func (b *Base) WriteBase(options WriteOptions) error {
 		}
 	}
 
+	if err := writeKustomization(renderDir, b.Files, options.ExcludeKotsKinds); err != nil {
+		return errors.Wrap(err, "failed to write base")
+	}
+
+	if len(b.Hooks) > 0 {
+		if err := writeKustomization(path.Join(renderDir, HooksDir), b.Hooks, options.ExcludeKotsKinds); err != nil {
+			return errors.Wrap(err, "failed to write hooks")
+		}
+	}
+
+	return nil
+}
+
+func writeKustomization(renderDir string, files []BaseFile, excludeKotsKinds bool) error {
 	kustomizeResources := []string{}
-	for _, file := range b.Files {
-		writeToBase := file.ShouldBeIncludedInBaseFilesystem(options.ExcludeKotsKinds)
-		writeToKustomization := file.ShouldBeIncludedInBaseKustomization(options.ExcludeKotsKinds)
+	for _, file := range files {
+		writeToBase := file.ShouldBeIncludedInBaseFilesystem(excludeKotsKinds)
+		writeToKustomization := file.ShouldBeIncludedInBaseKustomization(excludeKotsKinds)
 
 		if !writeToBase && !writeToKustomization {
 			continue
@@ -59,6 +73,10 @@ func (b *Base) WriteBase(options WriteOptions) error {
 		}
 	}
 
+	if err := os.MkdirAll(renderDir, 0744); err != nil {
+		return errors.Wrap(err, "failed to mkdir")
+	}
+
 	kustomization := kustomizetypes.Kustomization{
 		TypeMeta: kustomizetypes.TypeMeta{
 			APIVersion: "kustomize.config.k8s.io/v1beta1",
@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 
-	"github.com/mholt/archiver"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/archive"
+	"github.com/replicatedhq/kots/pkg/httpclient"
 	"github.com/replicatedhq/kots/pkg/k8sutil"
 	"github.com/replicatedhq/kots/pkg/logger"
 	corev1 "k8s.io/api/core/v1"
@@ -18,9 +18,10 @@ import (
 )
 
 type DownloadOptions struct {
-	Namespace  string
-	Kubeconfig string
-	Overwrite  bool
+	Namespace         string
+	Kubeconfig        string
+	Overwrite         bool
+	HTTPClientOptions httpclient.Options
 }
 
 func Download(appSlug string, path string, downloadOptions DownloadOptions) error {
@@ -41,7 +42,13 @@ func Download(appSlug string, path string, downloadOptions DownloadOptions) erro
 	}
 	defer close(stopCh)
 
-	resp, err := http.Get(fmt.Sprintf("http://localhost:3000/api/v1/kots/%s", appSlug))
+	client, err := httpclient.New(downloadOptions.HTTPClientOptions)
+	if err != nil {
+		log.FinishSpinnerWithError()
+		return errors.Wrap(err, "failed to create http client")
+	}
+
+	resp, err := client.Get(fmt.Sprintf("http://localhost:3000/api/v1/kots/%s", appSlug))
 	if err != nil {
 		log.FinishSpinnerWithError()
 		return errors.Wrap(err, "failed to get from kotsadm")
@@ -72,12 +79,8 @@ func Download(appSlug string, path string, downloadOptions DownloadOptions) erro
 		}
 	}
 
-	tarGz := archiver.TarGz{
-		Tar: &archiver.Tar{
-			ImplicitTopLevelFolder: false,
-		},
-	}
-	if err := tarGz.Unarchive(tmpFile.Name(), path); err != nil {
+	if err := archive.ExtractTarGzFile(tmpFile.Name(), path, archive.Options{}); err != nil {
+		log.FinishSpinnerWithError()
 		return errors.Wrap(err, "failed to extract tar gz")
 	}
 
@@ -6,7 +6,9 @@ import (
 	"path/filepath"
 
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/base"
 	"github.com/replicatedhq/kots/pkg/k8sutil"
+	kustomizetypes "sigs.k8s.io/kustomize/v3/pkg/types"
 )
 
 type WriteOptions struct {
@@ -27,7 +29,10 @@ func (d *Downstream) WriteDownstream(options WriteOptions) error {
 		// We intentionally don't support overwriting downstreams...  this is user-created content
 		// and the user should be intentional about removing it
 
-		// But it's also not an error
+		// But it's also not an error. The hooks might be new though.
+		if err := d.writeHooks(options); err != nil {
+			return errors.Wrap(err, "failed to write hooks")
+		}
 		return nil
 	}
 
@@ -47,5 +52,49 @@ func (d *Downstream) WriteDownstream(options WriteOptions) error {
 		return errors.Wrap(err, "failed to write kustomization to file")
 	}
 
+	if err := d.writeHooks(options); err != nil {
+		return errors.Wrap(err, "failed to write hooks")
+	}
+
+	return nil
+}
+
+// writeHooks writes a kustomization for the hooks on top of the hooks in the
+// midstream, that can be applied before the downstream. It's removed when there are
+// no hooks anymore, along with the midstream hooks it refers to.
+func (d *Downstream) writeHooks(options WriteOptions) error {
+	renderDir := path.Join(options.DownstreamDir, base.HooksDir)
+
+	if d.Midstream == nil || d.Midstream.Base == nil || len(d.Midstream.Base.Hooks) == 0 {
+		if err := os.RemoveAll(renderDir); err != nil {
+			return errors.Wrap(err, "failed to remove hooks")
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(renderDir); err == nil {
+		return nil
+	}
+
+	relativeMidstreamDir, err := filepath.Rel(renderDir, path.Join(options.MidstreamDir, base.HooksDir))
+	if err != nil {
+		return errors.Wrap(err, "failed to determine relative path for hooks from downstream")
+	}
+
+	if err := os.MkdirAll(renderDir, 0744); err != nil {
+		return errors.Wrap(err, "failed to mkdir")
+	}
+
+	kustomization := kustomizetypes.Kustomization{
+		TypeMeta: d.Kustomization.TypeMeta,
+		Bases: []string{
+			relativeMidstreamDir,
+		},
+	}
+
+	if err := k8sutil.WriteKustomizationToFile(&kustomization, path.Join(renderDir, "kustomization.yaml")); err != nil {
+		return errors.Wrap(err, "failed to write kustomization to file")
+	}
+
 	return nil
 }
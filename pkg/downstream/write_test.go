@@ -0,0 +1,61 @@
+package downstream
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/replicatedhq/kots/pkg/base"
+	"github.com/replicatedhq/kots/pkg/midstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteDownstreamHooks(t *testing.T) {
+	req := require.New(t)
+
+	rootDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(rootDir)
+
+	baseDir := path.Join(rootDir, "base")
+	midstreamDir := path.Join(rootDir, "overlays", "midstream")
+	downstreamDir := path.Join(rootDir, "overlays", "downstreams", "local")
+
+	pull := func(b *base.Base) {
+		m, err := midstream.CreateMidstream(b, nil)
+		req.NoError(err)
+		req.NoError(m.WriteMidstream(midstream.WriteOptions{
+			MidstreamDir: midstreamDir,
+			BaseDir:      baseDir,
+		}))
+
+		d, err := CreateDownstream(m, "local")
+		req.NoError(err)
+		req.NoError(d.WriteDownstream(WriteOptions{
+			DownstreamDir: downstreamDir,
+			MidstreamDir:  midstreamDir,
+		}))
+	}
+
+	pull(&base.Base{
+		Hooks: []base.BaseFile{
+			{Path: "job-migrate.yaml", Content: []byte("apiVersion: batch/v1\nkind: Job\n")},
+		},
+	})
+
+	hooksKustomization, err := ioutil.ReadFile(path.Join(downstreamDir, base.HooksDir, "kustomization.yaml"))
+	req.NoError(err)
+	assert.Contains(t, string(hooksKustomization), "../../../midstream/hooks")
+	assert.DirExists(t, path.Join(midstreamDir, base.HooksDir))
+
+	// the next pull has no hooks, so nothing should refer to them
+	pull(&base.Base{})
+
+	_, err = os.Stat(path.Join(midstreamDir, base.HooksDir))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(downstreamDir, base.HooksDir))
+	assert.True(t, os.IsNotExist(err))
+	assert.FileExists(t, path.Join(downstreamDir, "kustomization.yaml"))
+}
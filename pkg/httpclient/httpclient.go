@@ -0,0 +1,253 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	// DefaultTimeout is used when Options.Timeout is not set
+	DefaultTimeout = 5 * time.Minute
+
+	// DefaultMaxRetries is used when Options.MaxRetries is not set
+	DefaultMaxRetries = 3
+
+	maxBackoff = 30 * time.Second
+)
+
+// initialBackoff is how long to wait before the first retry, doubling for each retry
+// after that
+var initialBackoff = time.Second
+
+// Options configures the clients that are used for requests to the replicated api,
+// helm repos, registries and kotsadm. Zero values use the defaults.
+type Options struct {
+	// HTTPSProxy and NoProxy override the HTTPS_PROXY and NO_PROXY environment
+	// variables, which are used when these are not set
+	HTTPSProxy string
+	NoProxy    string
+
+	// CAFile is a pem bundle with certificates that are trusted in addition to the
+	// system roots, for proxies that intercept tls
+	CAFile string
+
+	// Timeout is the limit for a request, including retries and reading the body.
+	// A negative timeout disables it.
+	Timeout time.Duration
+
+	// MaxRetries is how many times a GET, HEAD or PUT request is retried after a 5xx
+	// response or a connection reset. A negative value disables retries.
+	MaxRetries int
+}
+
+// New returns a client that is configured with the options
+func New(options Options) (*http.Client, error) {
+	transport, err := NewTransport(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithTransport(transport, options), nil
+}
+
+// NewTransport returns a transport with the proxy and tls settings from the options,
+// for callers that need to customize it further before calling NewWithTransport
+func NewTransport(options Options) (*http.Transport, error) {
+	tlsConfig, err := getTLSConfig(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tls config")
+	}
+
+	proxyConfig := httpproxy.FromEnvironment()
+	if options.HTTPSProxy != "" {
+		proxyConfig.HTTPSProxy = options.HTTPSProxy
+	}
+	if options.NoProxy != "" {
+		proxyConfig.NoProxy = options.NoProxy
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+
+	// the same settings as http.DefaultTransport
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		},
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	return transport, nil
+}
+
+// NewWithTransport returns a client that sends requests with the transport, retrying
+// them and timing them out as configured in the options
+func NewWithTransport(transport http.RoundTripper, options Options) *http.Client {
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	} else if timeout < 0 {
+		timeout = 0
+	}
+
+	maxRetries := options.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &retryTransport{
+			transport:  transport,
+			maxRetries: maxRetries,
+		},
+	}
+}
+
+func getTLSConfig(options Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if options.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caData, err := ioutil.ReadFile(options.CAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read ca file")
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil || certPool == nil {
+		certPool = x509.NewCertPool()
+	}
+	if !certPool.AppendCertsFromPEM(caData) {
+		return nil, errors.Errorf("no certificates found in %s", options.CAFile)
+	}
+	tlsConfig.RootCAs = certPool
+
+	return tlsConfig, nil
+}
+
+// retryTransport retries requests with exponential backoff after a 5xx response or
+// a connection reset. Only idempotent requests are retried, because the server may
+// have acted on a request before it failed, such as an upload that was received.
+type retryTransport struct {
+	transport  http.RoundTripper
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	canResend := isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	backoff := initialBackoff
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		resp, err := t.transport.RoundTrip(attemptReq)
+		if !canResend || attempt >= t.maxRetries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		if err := sleep(req.Context(), backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		attemptReq, err = resendableRequest(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to reset request body")
+		}
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return isConnectionReset(err)
+	}
+
+	return resp.StatusCode >= 500
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut:
+		return true
+	}
+	return false
+}
+
+func isConnectionReset(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if syscallErr, ok := err.(*os.SyscallError); ok {
+		err = syscallErr.Err
+	}
+	if err == syscall.ECONNRESET {
+		return true
+	}
+
+	// the transport doesn't always return the underlying error
+	return strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// resendableRequest returns a copy of the request with a new body
+func resendableRequest(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	newReq := new(http.Request)
+	*newReq = *req
+	newReq.Body = body
+	return newReq, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,203 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_retryTransport(t *testing.T) {
+	initialBackoff = time.Millisecond
+	defer func() {
+		initialBackoff = time.Second
+	}()
+
+	tests := []struct {
+		name           string
+		method         string
+		failures       int32
+		resetConn      bool
+		maxRetries     int
+		expectStatus   int
+		expectError    bool
+		expectRequests int32
+	}{
+		{
+			name:           "get is retried after 5xx",
+			method:         "GET",
+			failures:       2,
+			expectStatus:   200,
+			expectRequests: 3,
+		},
+		{
+			name:           "gives up after max retries",
+			method:         "GET",
+			failures:       10,
+			maxRetries:     2,
+			expectStatus:   503,
+			expectRequests: 3,
+		},
+		{
+			name:           "post is not retried after 5xx",
+			method:         "POST",
+			failures:       1,
+			expectStatus:   503,
+			expectRequests: 1,
+		},
+		{
+			name:           "post is not retried after a connection reset",
+			method:         "POST",
+			failures:       1,
+			resetConn:      true,
+			expectError:    true,
+			expectRequests: 1,
+		},
+		{
+			name:           "put is retried after a connection reset",
+			method:         "PUT",
+			failures:       1,
+			resetConn:      true,
+			expectStatus:   200,
+			expectRequests: 2,
+		},
+		{
+			name:           "retries can be disabled",
+			method:         "GET",
+			failures:       1,
+			maxRetries:     -1,
+			expectStatus:   503,
+			expectRequests: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+
+				body, _ := ioutil.ReadAll(r.Body)
+				if r.Method != "GET" && string(body) != "payload" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if n <= test.failures {
+					if test.resetConn {
+						conn, _, err := w.(http.Hijacker).Hijack()
+						if err == nil {
+							conn.Close()
+						}
+						return
+					}
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			client, err := New(Options{MaxRetries: test.maxRetries})
+			req.NoError(err)
+
+			httpReq, err := http.NewRequest(test.method, server.URL, strings.NewReader("payload"))
+			req.NoError(err)
+
+			resp, err := client.Do(httpReq)
+			if test.expectError {
+				req.Error(err)
+			} else {
+				req.NoError(err)
+				defer resp.Body.Close()
+				assert.Equal(t, test.expectStatus, resp.StatusCode)
+			}
+
+			assert.Equal(t, test.expectRequests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func Test_CAFile(t *testing.T) {
+	req := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	caFile := filepath.Join(tmpDir, "ca.pem")
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	req.NoError(ioutil.WriteFile(caFile, caData, 0644))
+
+	client, err := New(Options{MaxRetries: -1})
+	req.NoError(err)
+	_, err = client.Get(server.URL)
+	req.Error(err)
+
+	client, err = New(Options{CAFile: caFile, MaxRetries: -1})
+	req.NoError(err)
+	resp, err := client.Get(server.URL)
+	req.NoError(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = New(Options{CAFile: filepath.Join(tmpDir, "missing.pem")})
+	req.Error(err)
+}
+
+func Test_NewTransportProxy(t *testing.T) {
+	req := require.New(t)
+
+	transport, err := NewTransport(Options{
+		HTTPSProxy: "http://proxy.example.com:3128",
+		NoProxy:    "internal.example.com",
+	})
+	req.NoError(err)
+
+	tests := []struct {
+		url         string
+		expectProxy string
+	}{
+		{
+			url:         "https://replicated.app/release/app-slug",
+			expectProxy: "http://proxy.example.com:3128",
+		},
+		{
+			url:         "https://charts.internal.example.com/index.yaml",
+			expectProxy: "",
+		},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		req.NoError(err)
+
+		proxyURL, err := transport.Proxy(&http.Request{URL: u})
+		req.NoError(err)
+
+		if test.expectProxy == "" {
+			assert.Nil(t, proxyURL, test.url)
+		} else {
+			req.NotNil(proxyURL, test.url)
+			assert.Equal(t, test.expectProxy, proxyURL.String(), test.url)
+		}
+	}
+}
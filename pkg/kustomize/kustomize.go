@@ -0,0 +1,52 @@
+package kustomize
+
+import (
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/upstream"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/validator"
+	"sigs.k8s.io/kustomize/v3/pkg/fs"
+	"sigs.k8s.io/kustomize/v3/pkg/loader"
+	"sigs.k8s.io/kustomize/v3/pkg/plugins"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+	"sigs.k8s.io/kustomize/v3/pkg/target"
+)
+
+func init() {
+	upstream.RegisterKustomizeBuild(Build)
+}
+
+// Build runs kustomize build on a local directory or a remote target, the same way
+// that the kustomize cli does, and returns the resources as a multi doc yaml
+func Build(kustomizeTarget string) ([]byte, error) {
+	fSys := fs.MakeRealFS()
+	uf := kunstruct.NewKunstructuredFactoryImpl()
+	pf := transformer.NewFactoryImpl()
+	rf := resmap.NewFactory(resource.NewFactory(uf), pf)
+	pl := plugins.NewLoader(plugins.DefaultPluginConfig(), rf)
+
+	ldr, err := loader.NewLoader(loader.RestrictionRootOnly, validator.NewKustValidator(), kustomizeTarget, fSys)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kustomization")
+	}
+	defer ldr.Cleanup()
+
+	kt, err := target.NewKustTarget(ldr, rf, pf, pl)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kustomize target")
+	}
+
+	resMap, err := kt.MakeCustomizedResMap()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make resources")
+	}
+
+	built, err := resMap.AsYaml()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal resources")
+	}
+
+	return built, nil
+}
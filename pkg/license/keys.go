@@ -0,0 +1,25 @@
+package license
+
+import (
+	"crypto/rsa"
+)
+
+// embeddedPublicKeyPEMs are the global public keys of the vendor portal, by the id
+// that signatures refer to them with. App keys signed by these are trusted without
+// configuring a public key.
+var embeddedPublicKeyPEMs = map[string]string{}
+
+var embeddedPublicKeys = mustParseEmbeddedPublicKeys(embeddedPublicKeyPEMs)
+
+func mustParseEmbeddedPublicKeys(pems map[string]string) map[string]*rsa.PublicKey {
+	publicKeys := map[string]*rsa.PublicKey{}
+	for id, data := range pems {
+		keys, err := ParsePublicKeys([]byte(data))
+		if err != nil || len(keys) != 1 {
+			panic("invalid embedded public key " + id)
+		}
+		publicKeys[id] = keys[0]
+	}
+
+	return publicKeys
+}
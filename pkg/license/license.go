@@ -0,0 +1,36 @@
+package license
+
+import (
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ParseLicense decodes a license. The signature is not verified.
+func ParseLicense(data []byte) (*kotsv1beta1.License, error) {
+	kotsscheme.AddToScheme(scheme.Scheme)
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, gvk, err := decode(data, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode license")
+	}
+
+	if gvk.Group != "kots.io" || gvk.Version != "v1beta1" || gvk.Kind != "License" {
+		return nil, errors.New("not an application license")
+	}
+
+	return obj.(*kotsv1beta1.License), nil
+}
+
+// VerifyWithPublicKeyFiles verifies the license with the public keys in the files.
+// ErrNoPublicKeys is returned when there are none, callers that trust licenses
+// without verifying them have to skip verification instead.
+func VerifyWithPublicKeyFiles(license *kotsv1beta1.License, publicKeyFiles []string) error {
+	publicKeys, err := LoadPublicKeys(publicKeyFiles)
+	if err != nil {
+		return errors.Wrap(err, "failed to load public keys")
+	}
+
+	return Verify(license, publicKeys)
+}
@@ -0,0 +1,285 @@
+package license
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+)
+
+var (
+	// ErrNotSigned is returned when verifying a license that has no signature
+	ErrNotSigned = errors.New("license is not signed")
+
+	// ErrNoPublicKeys is returned when there are no embedded or configured public keys to
+	// verify with. Licenses are never trusted without a public key, verification has to
+	// be skipped explicitly.
+	ErrNoPublicKeys = errors.New("no public keys to verify the license with")
+)
+
+// ErrInvalidSignature is returned when the signature does not match the license
+// for any of the public keys, which means that the license has been modified or was
+// signed by a different vendor
+type ErrInvalidSignature struct {
+	AppSlug   string
+	LicenseID string
+}
+
+func (e ErrInvalidSignature) Error() string {
+	return fmt.Sprintf("the signature of license %s for %s is not valid, the license may have been tampered with", e.LicenseID, e.AppSlug)
+}
+
+// outerSignature is what is stored in the signature of a license issued by the
+// vendor portal. The license data is the license as it was issued, signed with the
+// app's key.
+type outerSignature struct {
+	LicenseData    []byte `json:"licenseData"`
+	InnerSignature []byte `json:"innerSignature"`
+}
+
+// innerSignature carries the app's public key, which is signed by a global key so
+// that only app keys issued by the vendor portal are trusted
+type innerSignature struct {
+	LicenseSignature []byte `json:"licenseSignature"`
+	PublicKey        string `json:"publicKey"`
+	KeySignature     []byte `json:"keySignature"`
+}
+
+// keySignature is the signature of the app's public key by the global key
+type keySignature struct {
+	Signature   []byte `json:"signature"`
+	GlobalKeyID string `json:"globalKeyId"`
+}
+
+// Verify checks the license signature. The app key in the signature has to be
+// signed by the embedded global key with the same id, or by any of the configured
+// public keys, and the license that the app key signed has to be the same as the
+// license.
+func Verify(license *kotsv1beta1.License, publicKeys []*rsa.PublicKey) error {
+	if len(publicKeys) == 0 && len(embeddedPublicKeys) == 0 {
+		return ErrNoPublicKeys
+	}
+
+	if len(license.Spec.Signature) == 0 {
+		return ErrNotSigned
+	}
+
+	errInvalidSignature := ErrInvalidSignature{
+		AppSlug:   license.Spec.AppSlug,
+		LicenseID: license.Spec.LicenseID,
+	}
+
+	outer := outerSignature{}
+	if err := json.Unmarshal(license.Spec.Signature, &outer); err != nil {
+		return errInvalidSignature
+	}
+	inner := innerSignature{}
+	if err := json.Unmarshal(outer.InnerSignature, &inner); err != nil {
+		return errInvalidSignature
+	}
+	key := keySignature{}
+	if err := json.Unmarshal(inner.KeySignature, &key); err != nil {
+		return errInvalidSignature
+	}
+
+	globalKeys := publicKeys
+	if embeddedKey, ok := embeddedPublicKeys[key.GlobalKeyID]; ok {
+		globalKeys = append([]*rsa.PublicKey{embeddedKey}, publicKeys...)
+	}
+
+	verified := false
+	for _, globalKey := range globalKeys {
+		if verifySignature([]byte(inner.PublicKey), key.Signature, globalKey) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return errInvalidSignature
+	}
+
+	appKeys, err := ParsePublicKeys([]byte(inner.PublicKey))
+	if err != nil || len(appKeys) != 1 {
+		return errInvalidSignature
+	}
+	if err := verifySignature(outer.LicenseData, inner.LicenseSignature, appKeys[0]); err != nil {
+		return errInvalidSignature
+	}
+
+	signedLicense, err := ParseLicense(outer.LicenseData)
+	if err != nil {
+		return errInvalidSignature
+	}
+
+	signedSpec := signedLicense.Spec
+	signedSpec.Signature = nil
+	spec := license.Spec
+	spec.Signature = nil
+	if !reflect.DeepEqual(spec, signedSpec) {
+		return errInvalidSignature
+	}
+
+	return nil
+}
+
+// Sign returns the signature of the license data in the format that the vendor
+// portal uses, to be set as the signature of the license. The app key signs the
+// license data, which is the license without a signature, and the global key signs
+// the app's public key.
+func Sign(licenseData []byte, appKey *rsa.PrivateKey, globalKey *rsa.PrivateKey, globalKeyID string) ([]byte, error) {
+	appPublicKey, err := x509.MarshalPKIXPublicKey(&appKey.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal app public key")
+	}
+	appPublicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: appPublicKey})
+
+	appKeySignature, err := signMessage(appPublicKeyPEM, globalKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign app public key")
+	}
+	keySignatureData, err := json.Marshal(keySignature{
+		Signature:   appKeySignature,
+		GlobalKeyID: globalKeyID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal key signature")
+	}
+
+	licenseSignature, err := signMessage(licenseData, appKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign license")
+	}
+	innerSignatureData, err := json.Marshal(innerSignature{
+		LicenseSignature: licenseSignature,
+		PublicKey:        string(appPublicKeyPEM),
+		KeySignature:     keySignatureData,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal inner signature")
+	}
+
+	b, err := json.Marshal(outerSignature{
+		LicenseData:    licenseData,
+		InnerSignature: innerSignatureData,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal signature")
+	}
+
+	return b, nil
+}
+
+// signMessage and verifySignature use rsa-pss over the md5 of the message, which is
+// what the vendor portal signs licenses with
+func signMessage(message []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	hashed := md5.Sum(message)
+	return rsa.SignPSS(rand.Reader, privateKey, crypto.MD5, hashed[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+}
+
+func verifySignature(message []byte, signature []byte, publicKey *rsa.PublicKey) error {
+	hashed := md5.Sum(message)
+	return rsa.VerifyPSS(publicKey, crypto.MD5, hashed[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+}
+
+// LoadPublicKeys returns the public keys in the pem files
+func LoadPublicKeys(filenames []string) ([]*rsa.PublicKey, error) {
+	publicKeys := []*rsa.PublicKey{}
+
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read public key file")
+		}
+
+		filePublicKeys, err := ParsePublicKeys(content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public keys in %s", filename)
+		}
+		if len(filePublicKeys) == 0 {
+			return nil, errors.Errorf("no public keys found in %s", filename)
+		}
+
+		publicKeys = append(publicKeys, filePublicKeys...)
+	}
+
+	return publicKeys, nil
+}
+
+// ParsePublicKeys parses all of the rsa public keys in pem data, in either pkix or
+// pkcs1 format
+func ParsePublicKeys(data []byte) ([]*rsa.PublicKey, error) {
+	publicKeys := []*rsa.PublicKey{}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse public key")
+			}
+			publicKey, ok := key.(*rsa.PublicKey)
+			if !ok {
+				return nil, errors.New("public key is not an rsa key")
+			}
+			publicKeys = append(publicKeys, publicKey)
+		case "RSA PUBLIC KEY":
+			publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse rsa public key")
+			}
+			publicKeys = append(publicKeys, publicKey)
+		default:
+			continue
+		}
+	}
+
+	return publicKeys, nil
+}
+
+// ParsePrivateKey parses the first rsa private key in pem data, in either pkcs1 or
+// pkcs8 format
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse rsa private key")
+			}
+			return privateKey, nil
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse private key")
+			}
+			privateKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("private key is not an rsa key")
+			}
+			return privateKey, nil
+		}
+	}
+
+	return nil, errors.New("no private key found")
+}
@@ -0,0 +1,225 @@
+package license
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return privateKey
+}
+
+const unsignedLicense = `apiVersion: kots.io/v1beta1
+kind: License
+metadata:
+  name: my-app
+spec:
+  appSlug: my-app
+  endpoint: https://replicated.app
+  licenseID: abcdef
+`
+
+// mustSignLicense signs the license with the key as both the app key and the global key
+func mustSignLicense(t *testing.T, privateKey *rsa.PrivateKey) *kotsv1beta1.License {
+	return mustSignLicenseWithGlobalKey(t, privateKey, privateKey, "")
+}
+
+func mustSignLicenseWithGlobalKey(t *testing.T, appKey *rsa.PrivateKey, globalKey *rsa.PrivateKey, globalKeyID string) *kotsv1beta1.License {
+	license, err := ParseLicense([]byte(unsignedLicense))
+	require.NoError(t, err)
+
+	signature, err := Sign([]byte(unsignedLicense), appKey, globalKey, globalKeyID)
+	require.NoError(t, err)
+	license.Spec.Signature = signature
+
+	return license
+}
+
+// withEmbeddedPublicKeys replaces the embedded public keys until the returned func
+// is called
+func withEmbeddedPublicKeys(publicKeys map[string]*rsa.PublicKey) func() {
+	saved := embeddedPublicKeys
+	embeddedPublicKeys = publicKeys
+	return func() {
+		embeddedPublicKeys = saved
+	}
+}
+
+func Test_Verify(t *testing.T) {
+	vendorKey := mustGenerateKey(t)
+	otherKey := mustGenerateKey(t)
+
+	tests := []struct {
+		name        string
+		license     func() *kotsv1beta1.License
+		publicKeys  []*rsa.PublicKey
+		expectedErr error
+	}{
+		{
+			name: "valid",
+			license: func() *kotsv1beta1.License {
+				return mustSignLicense(t, vendorKey)
+			},
+			publicKeys: []*rsa.PublicKey{&otherKey.PublicKey, &vendorKey.PublicKey},
+		},
+		{
+			name: "modified",
+			license: func() *kotsv1beta1.License {
+				license := mustSignLicense(t, vendorKey)
+				license.Spec.IsAirgapSupported = true
+				return license
+			},
+			publicKeys:  []*rsa.PublicKey{&vendorKey.PublicKey},
+			expectedErr: ErrInvalidSignature{AppSlug: "my-app", LicenseID: "abcdef"},
+		},
+		{
+			name: "signed by another key",
+			license: func() *kotsv1beta1.License {
+				return mustSignLicense(t, otherKey)
+			},
+			publicKeys:  []*rsa.PublicKey{&vendorKey.PublicKey},
+			expectedErr: ErrInvalidSignature{AppSlug: "my-app", LicenseID: "abcdef"},
+		},
+		{
+			name: "app key signed by another key",
+			license: func() *kotsv1beta1.License {
+				return mustSignLicenseWithGlobalKey(t, vendorKey, otherKey, "")
+			},
+			publicKeys:  []*rsa.PublicKey{&vendorKey.PublicKey},
+			expectedErr: ErrInvalidSignature{AppSlug: "my-app", LicenseID: "abcdef"},
+		},
+		{
+			name: "not signed",
+			license: func() *kotsv1beta1.License {
+				license := mustSignLicense(t, vendorKey)
+				license.Spec.Signature = nil
+				return license
+			},
+			publicKeys:  []*rsa.PublicKey{&vendorKey.PublicKey},
+			expectedErr: ErrNotSigned,
+		},
+		{
+			name: "signature of a different license",
+			license: func() *kotsv1beta1.License {
+				other := mustSignLicense(t, vendorKey)
+				license, err := ParseLicense([]byte(strings.Replace(unsignedLicense, "abcdef", "ghijkl", 1)))
+				require.NoError(t, err)
+				license.Spec.Signature = other.Spec.Signature
+				return license
+			},
+			publicKeys:  []*rsa.PublicKey{&vendorKey.PublicKey},
+			expectedErr: ErrInvalidSignature{AppSlug: "my-app", LicenseID: "ghijkl"},
+		},
+		{
+			name: "no public keys",
+			license: func() *kotsv1beta1.License {
+				return mustSignLicense(t, vendorKey)
+			},
+			expectedErr: ErrNoPublicKeys,
+		},
+	}
+
+	defer withEmbeddedPublicKeys(map[string]*rsa.PublicKey{})()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Verify(test.license(), test.publicKeys)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func Test_VerifyWithEmbeddedPublicKeys(t *testing.T) {
+	req := require.New(t)
+
+	globalKey := mustGenerateKey(t)
+	appKey := mustGenerateKey(t)
+	defer withEmbeddedPublicKeys(map[string]*rsa.PublicKey{"global-key": &globalKey.PublicKey})()
+
+	// with no configured keys, licenses issued with an embedded global key are trusted
+	license := mustSignLicenseWithGlobalKey(t, appKey, globalKey, "global-key")
+	req.NoError(VerifyWithPublicKeyFiles(license, nil))
+
+	license.Spec.LicenseID = "ghijkl"
+	assert.Equal(t, ErrInvalidSignature{AppSlug: "my-app", LicenseID: "ghijkl"}, VerifyWithPublicKeyFiles(license, nil))
+
+	unknownKey := mustSignLicenseWithGlobalKey(t, appKey, globalKey, "other-global-key")
+	assert.Equal(t, ErrInvalidSignature{AppSlug: "my-app", LicenseID: "abcdef"}, VerifyWithPublicKeyFiles(unknownKey, nil))
+
+	selfSigned := mustSignLicenseWithGlobalKey(t, appKey, appKey, "global-key")
+	assert.Equal(t, ErrInvalidSignature{AppSlug: "my-app", LicenseID: "abcdef"}, VerifyWithPublicKeyFiles(selfSigned, nil))
+
+	unsigned, err := ParseLicense([]byte(unsignedLicense))
+	req.NoError(err)
+	assert.Equal(t, ErrNotSigned, VerifyWithPublicKeyFiles(unsigned, nil))
+}
+
+func Test_VerifyWithPublicKeyFiles(t *testing.T) {
+	req := require.New(t)
+	defer withEmbeddedPublicKeys(map[string]*rsa.PublicKey{})()
+
+	vendorKey := mustGenerateKey(t)
+
+	pkixBytes, err := x509.MarshalPKIXPublicKey(&vendorKey.PublicKey)
+	req.NoError(err)
+	publicKeyFile, err := ioutil.TempFile("", "kots")
+	req.NoError(err)
+	defer os.Remove(publicKeyFile.Name())
+	req.NoError(pem.Encode(publicKeyFile, &pem.Block{Type: "PUBLIC KEY", Bytes: pkixBytes}))
+	req.NoError(pem.Encode(publicKeyFile, &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&mustGenerateKey(t).PublicKey)}))
+	req.NoError(publicKeyFile.Close())
+
+	publicKeys, err := LoadPublicKeys([]string{publicKeyFile.Name()})
+	req.NoError(err)
+	assert.Len(t, publicKeys, 2)
+
+	license := mustSignLicense(t, vendorKey)
+	req.NoError(VerifyWithPublicKeyFiles(license, []string{publicKeyFile.Name()}))
+
+	license.Spec.AppSlug = "other-app"
+	err = VerifyWithPublicKeyFiles(license, []string{publicKeyFile.Name()})
+	req.Error(err)
+	assert.Contains(t, err.Error(), "tampered")
+
+	// without any embedded or configured public keys, licenses are not trusted
+	err = VerifyWithPublicKeyFiles(license, nil)
+	assert.Equal(t, ErrNoPublicKeys, err)
+
+	unsigned, err := ParseLicense([]byte(unsignedLicense))
+	req.NoError(err)
+	err = VerifyWithPublicKeyFiles(unsigned, nil)
+	assert.Equal(t, ErrNoPublicKeys, err)
+}
+
+func Test_ParsePrivateKey(t *testing.T) {
+	req := require.New(t)
+
+	vendorKey := mustGenerateKey(t)
+
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(vendorKey)
+	req.NoError(err)
+
+	for _, block := range []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(vendorKey)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8Bytes},
+	} {
+		privateKey, err := ParsePrivateKey(pem.EncodeToMemory(block))
+		req.NoError(err)
+		assert.Equal(t, vendorKey.D, privateKey.D)
+	}
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	req.Error(err)
+}
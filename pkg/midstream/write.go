@@ -6,7 +6,9 @@ import (
 	"path/filepath"
 
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/base"
 	"github.com/replicatedhq/kots/pkg/k8sutil"
+	kustomizetypes "sigs.k8s.io/kustomize/v3/pkg/types"
 )
 
 type WriteOptions struct {
@@ -24,7 +26,10 @@ func (m *Midstream) WriteMidstream(options WriteOptions) error {
 
 	_, err = os.Stat(renderDir)
 	if err == nil {
-		// no error, the midstream already exists
+		// no error, the midstream already exists, but the hooks might be new
+		if err := m.writeHooks(options); err != nil {
+			return errors.Wrap(err, "failed to write hooks")
+		}
 		return nil
 	}
 
@@ -44,5 +49,52 @@ func (m *Midstream) WriteMidstream(options WriteOptions) error {
 		return errors.Wrap(err, "failed to write kustomization to file")
 	}
 
+	if err := m.writeHooks(options); err != nil {
+		return errors.Wrap(err, "failed to write hooks")
+	}
+
+	return nil
+}
+
+// writeHooks writes a kustomization for the hooks in the base, with the same images
+// as the midstream, so that the hooks are changed the same way as the rest of the app.
+// Like the midstream, an existing hooks kustomization is not overwritten. When the
+// base no longer has hooks, the hooks kustomization is removed, because it refers to
+// hooks in the base that don't exist anymore.
+func (m *Midstream) writeHooks(options WriteOptions) error {
+	renderDir := path.Join(options.MidstreamDir, base.HooksDir)
+
+	if m.Base == nil || len(m.Base.Hooks) == 0 {
+		if err := os.RemoveAll(renderDir); err != nil {
+			return errors.Wrap(err, "failed to remove hooks")
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(renderDir); err == nil {
+		return nil
+	}
+
+	relativeBaseDir, err := filepath.Rel(renderDir, path.Join(options.BaseDir, base.HooksDir))
+	if err != nil {
+		return errors.Wrap(err, "failed to determine relative path for hooks from midstream")
+	}
+
+	if err := os.MkdirAll(renderDir, 0744); err != nil {
+		return errors.Wrap(err, "failed to mkdir")
+	}
+
+	kustomization := kustomizetypes.Kustomization{
+		TypeMeta: m.Kustomization.TypeMeta,
+		Bases: []string{
+			relativeBaseDir,
+		},
+		Images: m.Kustomization.Images,
+	}
+
+	if err := k8sutil.WriteKustomizationToFile(&kustomization, path.Join(renderDir, "kustomization.yaml")); err != nil {
+		return errors.Wrap(err, "failed to write kustomization to file")
+	}
+
 	return nil
 }
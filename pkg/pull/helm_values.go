@@ -0,0 +1,48 @@
+package pull
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/strvals"
+)
+
+// HelmValues are the values that helm charts are rendered with, given the same way
+// as they are to helm template
+type HelmValues struct {
+	ValuesFiles []string
+	Set         []string
+	SetString   []string
+}
+
+// read merges the values files in order, and then applies the set and set string
+// values on top of them, returning the result as yaml
+func (v HelmValues) read() ([]byte, error) {
+	values := chartutil.Values{}
+
+	for _, filename := range v.ValuesFiles {
+		fileValues, err := chartutil.ReadValuesFile(filename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read values file %s", filename)
+		}
+		values.MergeInto(fileValues)
+	}
+
+	for _, value := range v.Set {
+		if err := strvals.ParseInto(value, values); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse set value %q", value)
+		}
+	}
+
+	for _, value := range v.SetString {
+		if err := strvals.ParseIntoString(value, values); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse set string value %q", value)
+		}
+	}
+
+	b, err := values.YAML()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal values")
+	}
+
+	return []byte(b), nil
+}
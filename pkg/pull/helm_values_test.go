@@ -0,0 +1,78 @@
+package pull
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HelmValuesRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kots")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	valuesFile := filepath.Join(dir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(valuesFile, []byte("image:\n  repository: redis\n  tag: \"5\"\nreplicas: 1\n"), 0644))
+
+	overridesFile := filepath.Join(dir, "overrides.yaml")
+	require.NoError(t, ioutil.WriteFile(overridesFile, []byte("image:\n  tag: \"6\"\n"), 0644))
+
+	tests := []struct {
+		name       string
+		helmValues HelmValues
+		expected   string
+		expectErr  bool
+	}{
+		{
+			name:       "no values",
+			helmValues: HelmValues{},
+			expected:   "{}\n",
+		},
+		{
+			name: "values files are merged in order",
+			helmValues: HelmValues{
+				ValuesFiles: []string{valuesFile, overridesFile},
+			},
+			expected: "image:\n  repository: redis\n  tag: \"6\"\nreplicas: 1\n",
+		},
+		{
+			name: "set values override values files",
+			helmValues: HelmValues{
+				ValuesFiles: []string{valuesFile},
+				Set:         []string{"replicas=3,ingress.hosts={a.example.com,b.example.com}"},
+				SetString:   []string{"image.tag=7"},
+			},
+			expected: "image:\n  repository: redis\n  tag: \"7\"\ningress:\n  hosts:\n  - a.example.com\n  - b.example.com\nreplicas: 3\n",
+		},
+		{
+			name: "missing values file",
+			helmValues: HelmValues{
+				ValuesFiles: []string{filepath.Join(dir, "missing.yaml")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid set value",
+			helmValues: HelmValues{
+				Set: []string{"replicas"},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := test.helmValues.read()
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(values))
+		})
+	}
+}
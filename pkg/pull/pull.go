@@ -7,30 +7,62 @@ import (
 
 	"github.com/pkg/errors"
 	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
-	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
 	"github.com/replicatedhq/kots/pkg/base"
 	"github.com/replicatedhq/kots/pkg/downstream"
+	"github.com/replicatedhq/kots/pkg/httpclient"
 	kotsimage "github.com/replicatedhq/kots/pkg/image"
+	"github.com/replicatedhq/kots/pkg/k8sutil"
+	kotslicense "github.com/replicatedhq/kots/pkg/license"
 	"github.com/replicatedhq/kots/pkg/logger"
 	"github.com/replicatedhq/kots/pkg/midstream"
 	"github.com/replicatedhq/kots/pkg/upstream"
-	"k8s.io/client-go/kubernetes/scheme"
+	"github.com/replicatedhq/kots/pkg/util"
 	"sigs.k8s.io/kustomize/v3/pkg/image"
 )
 
 type PullOptions struct {
-	HelmRepoURI         string
-	RootDir             string
-	Namespace           string
-	Downstreams         []string
-	LocalPath           string
-	LicenseFile         string
-	ExcludeKotsKinds    bool
-	ExcludeAdminConsole bool
-	SharedPassword      string
-	CreateAppDir        bool
-	Silent              bool
-	RewriteImages       RewriteImages
+	HelmRepoURI             string
+	HelmRepoAuth            HelmRepoAuth
+	HelmReposFile           string
+	IncludePrereleases      bool
+	CacheDir                string
+	Offline                 bool
+	RootDir                 string
+	Namespace               string
+	Downstreams             []string
+	LocalPath               string
+	LicenseFile             string
+	LicensePublicKeyFiles   []string
+	SkipLicenseVerification bool
+	ExcludeKotsKinds        bool
+	ExcludeAdminConsole     bool
+	SharedPassword          string
+	CreateAppDir            bool
+	Silent                  bool
+	RewriteImages           RewriteImages
+	HelmValues              HelmValues
+	IncludeHelmTests        bool
+	Capabilities            Capabilities
+	HTTPClientOptions       httpclient.Options
+}
+
+// Capabilities are the kubernetes version and api versions that helm charts are
+// rendered for. When Discover is set, the values that aren't set are discovered from
+// the cluster in the kubeconfig.
+type Capabilities struct {
+	KubeVersion string
+	APIVersions []string
+	Discover    bool
+	Kubeconfig  string
+}
+
+type HelmRepoAuth struct {
+	Username           string
+	Password           string
+	CertFile           string
+	KeyFile            string
+	CAFile             string
+	InsecureSkipVerify bool
 }
 
 type RewriteImages struct {
@@ -40,8 +72,13 @@ type RewriteImages struct {
 }
 
 // PullApplicationMetadata will return the application metadata yaml, if one is
-// available for the upstream
-func PullApplicationMetadata(upstreamURI string) ([]byte, error) {
+// available for the upstream. The metadata is requested from the endpoint in the
+// license, when there is one.
+func PullApplicationMetadata(upstreamURI string, pullOptions PullOptions) ([]byte, error) {
+	if !util.IsURL(upstreamURI) {
+		return nil, nil
+	}
+
 	u, err := url.ParseRequestURI(upstreamURI)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse uri")
@@ -52,7 +89,12 @@ func PullApplicationMetadata(upstreamURI string) ([]byte, error) {
 		return nil, nil
 	}
 
-	data, err := upstream.GetApplicationMetadata(u)
+	fetchOptions, err := getFetchOptions(pullOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get fetch options")
+	}
+
+	data, err := upstream.GetApplicationMetadata(u, fetchOptions)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get application metadata")
 	}
@@ -63,18 +105,33 @@ func PullApplicationMetadata(upstreamURI string) ([]byte, error) {
 // CanPullUpstream will return a bool indicating if the specified upstream
 // is accessible and authenticed for us.
 func CanPullUpstream(upstreamURI string, pullOptions PullOptions) (bool, error) {
-	u, err := url.ParseRequestURI(upstreamURI)
+	fetchOptions, err := getFetchOptions(pullOptions)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to parse uri")
+		return false, errors.Wrap(err, "failed to get fetch options")
 	}
 
-	if u.Scheme != "replicated" {
-		return true, nil
+	canFetch, err := upstream.CanFetchUpstream(upstreamURI, fetchOptions)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check upstream")
 	}
 
-	// For now, we shortcut http checks because all replicated:// app types
-	// require a license to pull.
-	return pullOptions.LicenseFile != "", nil
+	return canFetch, nil
+}
+
+// ListUpdates returns the versions of the upstream that are newer than the current
+// cursor, without pulling the upstream
+func ListUpdates(upstreamURI string, currentCursor string, pullOptions PullOptions) ([]upstream.Update, error) {
+	fetchOptions, err := getFetchOptions(pullOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get fetch options")
+	}
+
+	updates, err := upstream.ListUpdates(upstreamURI, currentCursor, fetchOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list updates")
+	}
+
+	return updates, nil
 }
 
 // Pull will download the application specified in upstreamURI using the options
@@ -88,38 +145,56 @@ func Pull(upstreamURI string, pullOptions PullOptions) (string, error) {
 
 	log.Initialize()
 
-	uri, err := url.ParseRequestURI(upstreamURI)
+	fetchOptions, err := getFetchOptions(pullOptions)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to parse uri")
+		return "", errors.Wrap(err, "failed to get fetch options")
 	}
 
-	fetchOptions := upstream.FetchOptions{}
-	fetchOptions.HelmRepoURI = pullOptions.HelmRepoURI
-	fetchOptions.LocalPath = pullOptions.LocalPath
+	log.ActionWithSpinner("Pulling upstream")
+	u, err := upstream.FetchUpstream(upstreamURI, fetchOptions)
+	if err != nil {
+		log.FinishSpinnerWithError()
+		return "", errors.Wrap(err, "failed to fetch upstream")
+	}
 
-	if pullOptions.LicenseFile != "" {
-		license, err := parseLicenseFromFile(pullOptions.LicenseFile)
+	// the values are written with the upstream so that they are merged with the values
+	// from the last pull, and kept for the next one
+	if u.Type == "helm" {
+		helmValues, err := pullOptions.HelmValues.read()
 		if err != nil {
-			return "", errors.Wrap(err, "failed to parse license from file")
+			log.FinishSpinnerWithError()
+			return "", errors.Wrap(err, "failed to read helm values")
 		}
 
-		fetchOptions.License = license
+		u.Files = append(u.Files, upstream.UpstreamFile{
+			Path:    upstream.HelmValuesPath,
+			Content: helmValues,
+		})
 	}
 
-	log.ActionWithSpinner("Pulling upstream")
-	u, err := upstream.FetchUpstream(upstreamURI, &fetchOptions)
+	kubeVersion, apiVersions, err := resolveCapabilities(pullOptions.Capabilities)
 	if err != nil {
 		log.FinishSpinnerWithError()
-		return "", errors.Wrap(err, "failed to fetch upstream")
+		return "", errors.Wrap(err, "failed to resolve capabilities")
 	}
 
-	includeAdminConsole := uri.Scheme == "replicated" && !pullOptions.ExcludeAdminConsole
+	includeAdminConsole := false
+	if util.IsURL(upstreamURI) {
+		uri, err := url.ParseRequestURI(upstreamURI)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to parse uri")
+		}
+
+		includeAdminConsole = uri.Scheme == "replicated" && !pullOptions.ExcludeAdminConsole
+	}
 
 	writeUpstreamOptions := upstream.WriteOptions{
 		RootDir:             pullOptions.RootDir,
 		CreateAppDir:        pullOptions.CreateAppDir,
 		IncludeAdminConsole: includeAdminConsole,
 		SharedPassword:      pullOptions.SharedPassword,
+		KubeVersion:         kubeVersion,
+		APIVersions:         apiVersions,
 	}
 	if err := u.WriteUpstream(writeUpstreamOptions); err != nil {
 		log.FinishSpinnerWithError()
@@ -127,9 +202,17 @@ func Pull(upstreamURI string, pullOptions PullOptions) (string, error) {
 	}
 	log.FinishSpinner()
 
+	if u.ApplicationMetadataErr != nil {
+		log.Info("Using the cached application metadata: %s", u.ApplicationMetadataErr.Error())
+	}
+
 	renderOptions := base.RenderOptions{
 		SplitMultiDocYAML: true,
 		Namespace:         pullOptions.Namespace,
+		HelmValues:        u.GetHelmValues(),
+		KubeVersion:       kubeVersion,
+		APIVersions:       apiVersions,
+		IncludeHelmTests:  pullOptions.IncludeHelmTests,
 	}
 	log.ActionWithSpinner("Creating base")
 	b, err := base.RenderUpstream(u, &renderOptions)
@@ -199,22 +282,79 @@ func Pull(upstreamURI string, pullOptions PullOptions) (string, error) {
 	return filepath.Join(pullOptions.RootDir, u.Name), nil
 }
 
+// resolveCapabilities returns the capabilities to render with, discovering the ones
+// that were not given from the cluster when asked to. The kubernetes version is the
+// default one when it's not given or discovered.
+func resolveCapabilities(capabilities Capabilities) (string, []string, error) {
+	kubeVersion := capabilities.KubeVersion
+	apiVersions := capabilities.APIVersions
+
+	if capabilities.Discover && (kubeVersion == "" || len(apiVersions) == 0) {
+		discoveredKubeVersion, discoveredAPIVersions, err := k8sutil.DiscoverCapabilities(capabilities.Kubeconfig)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to discover capabilities")
+		}
+
+		if kubeVersion == "" {
+			kubeVersion = discoveredKubeVersion
+		}
+		if len(apiVersions) == 0 {
+			apiVersions = discoveredAPIVersions
+		}
+	}
+
+	// record the version that charts are rendered for, not that none was given
+	if kubeVersion == "" {
+		kubeVersion = base.DefaultKubeVersion
+	}
+
+	return kubeVersion, apiVersions, nil
+}
+
+func getFetchOptions(pullOptions PullOptions) (*upstream.FetchOptions, error) {
+	fetchOptions := upstream.FetchOptions{}
+	fetchOptions.HelmRepoURI = pullOptions.HelmRepoURI
+	fetchOptions.HelmRepoUsername = pullOptions.HelmRepoAuth.Username
+	fetchOptions.HelmRepoPassword = pullOptions.HelmRepoAuth.Password
+	fetchOptions.HelmRepoCertFile = pullOptions.HelmRepoAuth.CertFile
+	fetchOptions.HelmRepoKeyFile = pullOptions.HelmRepoAuth.KeyFile
+	fetchOptions.HelmRepoCAFile = pullOptions.HelmRepoAuth.CAFile
+	fetchOptions.HelmRepoInsecureSkipVerify = pullOptions.HelmRepoAuth.InsecureSkipVerify
+	fetchOptions.HelmIncludePrereleases = pullOptions.IncludePrereleases
+	fetchOptions.HelmReposFile = pullOptions.HelmReposFile
+	fetchOptions.LocalPath = pullOptions.LocalPath
+	fetchOptions.CacheDir = pullOptions.CacheDir
+	fetchOptions.Offline = pullOptions.Offline
+	fetchOptions.HTTPClientOptions = pullOptions.HTTPClientOptions
+
+	if pullOptions.LicenseFile != "" {
+		license, err := parseLicenseFromFile(pullOptions.LicenseFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse license from file")
+		}
+
+		if !pullOptions.SkipLicenseVerification {
+			if err := kotslicense.VerifyWithPublicKeyFiles(license, pullOptions.LicensePublicKeyFiles); err != nil {
+				return nil, errors.Wrap(err, "failed to verify license")
+			}
+		}
+
+		fetchOptions.License = license
+	}
+
+	return &fetchOptions, nil
+}
+
 func parseLicenseFromFile(filename string) (*kotsv1beta1.License, error) {
 	contents, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read license file")
 	}
 
-	kotsscheme.AddToScheme(scheme.Scheme)
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	license, gvk, err := decode(contents, nil, nil)
+	license, err := kotslicense.ParseLicense(contents)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to decode license file")
-	}
-
-	if gvk.Group != "kots.io" || gvk.Version != "v1beta1" || gvk.Kind != "License" {
-		return nil, errors.New("not an application license")
+		return nil, errors.Wrap(err, "failed to parse license file")
 	}
 
-	return license.(*kotsv1beta1.License), nil
+	return license, nil
 }
@@ -0,0 +1,51 @@
+package pull
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/kots/pkg/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_resolveCapabilities(t *testing.T) {
+	tests := []struct {
+		name                string
+		capabilities        Capabilities
+		expectedKubeVersion string
+		expectedAPIVersions []string
+	}{
+		{
+			name:                "default kube version",
+			expectedKubeVersion: base.DefaultKubeVersion,
+		},
+		{
+			name: "given capabilities",
+			capabilities: Capabilities{
+				KubeVersion: "1.14.3",
+				APIVersions: []string{"apps/v1"},
+			},
+			expectedKubeVersion: "1.14.3",
+			expectedAPIVersions: []string{"apps/v1"},
+		},
+		{
+			name: "given capabilities are not discovered",
+			capabilities: Capabilities{
+				Discover:    true,
+				KubeVersion: "1.15.0",
+				APIVersions: []string{"apps/v1"},
+			},
+			expectedKubeVersion: "1.15.0",
+			expectedAPIVersions: []string{"apps/v1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubeVersion, apiVersions, err := resolveCapabilities(test.capabilities)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedKubeVersion, kubeVersion)
+			assert.Equal(t, test.expectedAPIVersions, apiVersions)
+		})
+	}
+}
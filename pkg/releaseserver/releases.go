@@ -0,0 +1,119 @@
+package releaseserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReleaseNotesFilename is the file in a release dir with the release notes. It's
+// not included in the release archive.
+const ReleaseNotesFilename = "release-notes.md"
+
+// Release is a single release of the app, promoted to a channel
+type Release struct {
+	Channel      string
+	Sequence     int
+	VersionLabel string
+	ReleaseNotes string
+	ReleasedAt   time.Time
+	Dir          string
+}
+
+// LoadReleases reads the releases in a releases dir. Each channel is a directory, and
+// each release in the channel is a directory named by its sequence, optionally
+// followed by a dash and the version label:
+//
+//	releases/stable/1-v1.0.0/deployment.yaml
+//	releases/stable/2-v1.1.0/deployment.yaml
+//	releases/beta/1/deployment.yaml
+//
+// The release notes are read from release-notes.md in the release dir, and the
+// release is dated with the modification time of the release dir.
+func LoadReleases(releasesDir string) ([]Release, error) {
+	channelDirs, err := ioutil.ReadDir(releasesDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read releases dir")
+	}
+
+	releases := []Release{}
+	for _, channelDir := range channelDirs {
+		if !channelDir.IsDir() {
+			continue
+		}
+
+		releaseDirs, err := ioutil.ReadDir(filepath.Join(releasesDir, channelDir.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read channel %s", channelDir.Name())
+		}
+
+		for _, releaseDir := range releaseDirs {
+			if !releaseDir.IsDir() {
+				continue
+			}
+
+			sequence, versionLabel, err := parseReleaseDirName(releaseDir.Name())
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse release dir in channel %s", channelDir.Name())
+			}
+
+			dir := filepath.Join(releasesDir, channelDir.Name(), releaseDir.Name())
+
+			releaseNotes, err := ioutil.ReadFile(filepath.Join(dir, ReleaseNotesFilename))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, errors.Wrapf(err, "failed to read release notes in %s", dir)
+			}
+
+			releases = append(releases, Release{
+				Channel:      channelDir.Name(),
+				Sequence:     sequence,
+				VersionLabel: versionLabel,
+				ReleaseNotes: strings.TrimSpace(string(releaseNotes)),
+				ReleasedAt:   releaseDir.ModTime(),
+				Dir:          dir,
+			})
+		}
+	}
+
+	if len(releases) == 0 {
+		return nil, errors.Errorf("no releases found in %s", releasesDir)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Channel != releases[j].Channel {
+			return releases[i].Channel < releases[j].Channel
+		}
+		return releases[i].Sequence < releases[j].Sequence
+	})
+
+	for i := 1; i < len(releases); i++ {
+		if releases[i].Channel == releases[i-1].Channel && releases[i].Sequence == releases[i-1].Sequence {
+			return nil, errors.Errorf("channel %s has more than one release with sequence %d", releases[i].Channel, releases[i].Sequence)
+		}
+	}
+
+	return releases, nil
+}
+
+// parseReleaseDirName parses "42" and "42-v1.2.0" release dir names
+func parseReleaseDirName(name string) (int, string, error) {
+	sequencePart := name
+	versionLabel := ""
+	if i := strings.Index(name, "-"); i != -1 {
+		sequencePart = name[:i]
+		versionLabel = name[i+1:]
+	}
+
+	sequence, err := strconv.Atoi(sequencePart)
+	if err != nil || sequence < 0 {
+		return 0, "", errors.Errorf("release dir %q does not start with a sequence", name)
+	}
+
+	return sequence, versionLabel, nil
+}
@@ -0,0 +1,431 @@
+package releaseserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultChannel is the channel that is served when the request doesn't name one
+const DefaultChannel = "stable"
+
+// PendingReleasesPath is the path after the app slug that lists pending releases,
+// with the channel in the channel param
+const PendingReleasesPath = "pending-releases"
+
+// PendingReleases is the response to a request for the releases that are newer than
+// the installed release
+type PendingReleases struct {
+	ChannelReleases []PendingRelease `json:"channelReleases"`
+}
+
+// PendingRelease is a release in PendingReleases
+type PendingRelease struct {
+	ChannelSequence int    `json:"channelSequence"`
+	VersionLabel    string `json:"versionLabel"`
+	ReleaseNotes    string `json:"releaseNotes"`
+}
+
+// Server serves releases with the same api that replicated.app serves them with, so
+// that licensed installs can be tested without the vendor portal
+type Server struct {
+	Releases []Release
+	Licenses []*kotsv1beta1.License
+}
+
+// NewServer loads the releases in the releases dir and returns a server that only
+// accepts requests made with one of the licenses
+func NewServer(releasesDir string, licenses []*kotsv1beta1.License) (*Server, error) {
+	if len(licenses) == 0 {
+		return nil, errors.New("at least one license is required")
+	}
+
+	releases, err := LoadReleases(releasesDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load releases")
+	}
+
+	return &Server{
+		Releases: releases,
+		Licenses: licenses,
+	}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// the channel is a param, so that the path can't be mistaken for a channel
+	if len(parts) == 3 && parts[0] == "release" && parts[2] == PendingReleasesPath {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.servePending(w, r, parts[1], r.URL.Query().Get("channel"))
+		return
+	}
+
+	if len(parts) < 2 || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	appSlug := parts[1]
+	channel := ""
+	if len(parts) == 3 {
+		channel = parts[2]
+	}
+
+	switch parts[0] {
+	case "release":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveRelease(w, r, appSlug, channel)
+	case "metadata":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveMetadata(w, r, appSlug, channel)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveRelease(w http.ResponseWriter, r *http.Request, appSlug string, channel string) {
+	if !s.isAuthorized(r, appSlug) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	release, err := s.findRelease(channel, r.URL.Query().Get("sequence"), r.URL.Query().Get("versionLabel"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if release == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	archive, err := archiveRelease(release)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("X-Replicated-Sequence", strconv.Itoa(release.Sequence))
+	w.Header().Set("X-Replicated-VersionLabel", release.VersionLabel)
+	w.Header().Set("X-Replicated-ChannelName", release.Channel)
+	w.Header().Set("X-Replicated-ReleasedAt", release.ReleasedAt.UTC().Format(time.RFC3339))
+	if release.ReleaseNotes != "" {
+		w.Header().Set("X-Replicated-ReleaseNotes", url.PathEscape(release.ReleaseNotes))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(archive)
+}
+
+// servePending lists the releases in the channel that are newer than the
+// channelSequence param
+func (s *Server) servePending(w http.ResponseWriter, r *http.Request, appSlug string, channel string) {
+	if !s.isAuthorized(r, appSlug) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if channel == "" {
+		channel = s.defaultChannel()
+	}
+
+	currentSequence := -1
+	if channelSequence := r.URL.Query().Get("channelSequence"); channelSequence != "" {
+		parsed, err := strconv.Atoi(channelSequence)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid channel sequence %q", channelSequence), http.StatusBadRequest)
+			return
+		}
+		currentSequence = parsed
+	}
+
+	pending := PendingReleases{
+		ChannelReleases: []PendingRelease{},
+	}
+	for _, release := range s.Releases {
+		if release.Channel != channel || release.Sequence <= currentSequence {
+			continue
+		}
+
+		pending.ChannelReleases = append(pending.ChannelReleases, PendingRelease{
+			ChannelSequence: release.Sequence,
+			VersionLabel:    release.VersionLabel,
+			ReleaseNotes:    release.ReleaseNotes,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// serveMetadata returns the kots Application from the head of the channel. Metadata
+// is requested before there is a license, so it's not authenticated.
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request, appSlug string, channel string) {
+	if !s.servesApp(appSlug) {
+		http.NotFound(w, r)
+		return
+	}
+
+	release, err := s.findRelease(channel, "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if release == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	application, err := findApplication(release)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if application == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(application)
+}
+
+// isAuthorized returns true when the request has basic auth of a license for the app,
+// with the license id as both the username and the password
+func (s *Server) isAuthorized(r *http.Request, appSlug string) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != password {
+		return false
+	}
+
+	for _, license := range s.Licenses {
+		if license.Spec.AppSlug == appSlug && license.Spec.LicenseID == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// servesApp returns true when there is a license for the app
+func (s *Server) servesApp(appSlug string) bool {
+	for _, license := range s.Licenses {
+		if license.Spec.AppSlug == appSlug {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findRelease returns the release in the channel with the sequence or the version
+// label, or the head of the channel when neither are set. Nil is returned when there
+// is no such release.
+func (s *Server) findRelease(channel string, sequenceParam string, versionLabel string) (*Release, error) {
+	if channel == "" {
+		channel = s.defaultChannel()
+	}
+
+	sequence := -1
+	if sequenceParam != "" {
+		parsed, err := strconv.Atoi(sequenceParam)
+		if err != nil || parsed < 0 {
+			return nil, errors.Errorf("invalid sequence %q", sequenceParam)
+		}
+		sequence = parsed
+	}
+
+	var found *Release
+	for i, release := range s.Releases {
+		if release.Channel != channel {
+			continue
+		}
+		if sequence != -1 && release.Sequence != sequence {
+			continue
+		}
+		if versionLabel != "" && release.VersionLabel != versionLabel {
+			continue
+		}
+
+		// releases are sorted by sequence, so the last match is the newest
+		found = &s.Releases[i]
+	}
+
+	return found, nil
+}
+
+// defaultChannel is the stable channel, unless there is only one channel
+func (s *Server) defaultChannel() string {
+	channel := ""
+	for _, release := range s.Releases {
+		if release.Channel == DefaultChannel {
+			return DefaultChannel
+		}
+		if channel != "" && channel != release.Channel {
+			return DefaultChannel
+		}
+		channel = release.Channel
+	}
+
+	return channel
+}
+
+// archiveRelease returns the files in the release dir as a gzipped tar
+func archiveRelease(release *Release) ([]byte, error) {
+	var b bytes.Buffer
+	gzipWriter := gzip.NewWriter(&b)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := filepath.Walk(release.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(release.Dir, path)
+		if err != nil {
+			return errors.Wrap(err, "failed to get relative path")
+		}
+		if relPath == ReleaseNotesFilename {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to read file")
+		}
+
+		header := &tar.Header{
+			Name:     filepath.ToSlash(relPath),
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return errors.Wrap(err, "failed to write tar header")
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return errors.Wrap(err, "failed to write tar file")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk release dir")
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close tar writer")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close gzip writer")
+	}
+
+	return b.Bytes(), nil
+}
+
+// findApplication returns the kots Application document in the release, or nil
+func findApplication(release *Release) ([]byte, error) {
+	var application []byte
+
+	err := filepath.Walk(release.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if application != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		ext := filepath.Ext(path)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to read file")
+		}
+
+		for _, doc := range strings.Split(string(content), "\n---") {
+			o := struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+			}{}
+			if err := yaml.Unmarshal([]byte(doc), &o); err != nil {
+				continue
+			}
+
+			if o.APIVersion == "kots.io/v1beta1" && o.Kind == "Application" {
+				application = []byte(strings.TrimPrefix(strings.TrimSpace(doc), "---\n"))
+				return nil
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk release dir")
+	}
+
+	return application, nil
+}
+
+// NewLicense returns a license for the app with a random license id, that can be
+// used to pull from a server at the endpoint
+func NewLicense(appSlug string, endpoint string) (*kotsv1beta1.License, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errors.Wrap(err, "failed to generate license id")
+	}
+
+	return &kotsv1beta1.License{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "kots.io/v1beta1",
+			Kind:       "License",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: appSlug,
+		},
+		Spec: kotsv1beta1.LicenseSpec{
+			AppSlug:   appSlug,
+			Endpoint:  endpoint,
+			LicenseID: hex.EncodeToString(id),
+		},
+	}, nil
+}
@@ -0,0 +1,258 @@
+package releaseserver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const application = `apiVersion: kots.io/v1beta1
+kind: Application
+metadata:
+  name: my-app
+spec:
+  title: My App`
+
+func mustWriteReleases(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "kots")
+	require.NoError(t, err)
+
+	for filename, content := range files {
+		filename = filepath.Join(dir, filename)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	}
+
+	return dir
+}
+
+func mustReadTarGz(t *testing.T, r io.Reader) map[string]string {
+	gzr, err := gzip.NewReader(r)
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	tarReader := tar.NewReader(gzr)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := ioutil.ReadAll(tarReader)
+		require.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+
+	return files
+}
+
+func Test_parseReleaseDirName(t *testing.T) {
+	tests := []struct {
+		name                 string
+		expectedSequence     int
+		expectedVersionLabel string
+		expectErr            bool
+	}{
+		{
+			name:             "42",
+			expectedSequence: 42,
+		},
+		{
+			name:                 "42-v1.2.0",
+			expectedSequence:     42,
+			expectedVersionLabel: "v1.2.0",
+		},
+		{
+			name:                 "3-v1.2.0-beta.1",
+			expectedSequence:     3,
+			expectedVersionLabel: "v1.2.0-beta.1",
+		},
+		{
+			name:      "v1.2.0",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sequence, versionLabel, err := parseReleaseDirName(test.name)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedSequence, sequence)
+			assert.Equal(t, test.expectedVersionLabel, versionLabel)
+		})
+	}
+}
+
+func Test_Server(t *testing.T) {
+	req := require.New(t)
+
+	releasesDir := mustWriteReleases(t, map[string]string{
+		"stable/1-v1.0.0/deployment.yaml":  "version: 1",
+		"stable/2-v1.1.0/deployment.yaml":  "version: 2",
+		"stable/2-v1.1.0/release-notes.md": "Fixes the thing\n\nAnd another",
+		"stable/10-v1.2.0/deployment.yaml": "version: 10",
+		"stable/10-v1.2.0/app.yaml":        "---\n" + application,
+		"beta/1/deployment.yaml":           "version: beta",
+		"pending/1-v2.0.0/deployment.yaml": "version: pending",
+	})
+	defer os.RemoveAll(releasesDir)
+
+	server, err := NewServer(releasesDir, []*kotsv1beta1.License{
+		{
+			Spec: kotsv1beta1.LicenseSpec{
+				AppSlug:   "my-app",
+				LicenseID: "license-id",
+			},
+		},
+	})
+	req.NoError(err)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	tests := []struct {
+		name                 string
+		path                 string
+		licenseID            string
+		expectedStatus       int
+		expectedSequence     string
+		expectedVersionLabel string
+		expectedChannel      string
+		expectedReleaseNotes string
+		expectedFiles        map[string]string
+	}{
+		{
+			name:                 "head of the default channel",
+			path:                 "/release/my-app",
+			licenseID:            "license-id",
+			expectedStatus:       http.StatusOK,
+			expectedSequence:     "10",
+			expectedVersionLabel: "v1.2.0",
+			expectedChannel:      "stable",
+			expectedFiles:        map[string]string{"deployment.yaml": "version: 10", "app.yaml": "---\n" + application},
+		},
+		{
+			name:                 "head of a channel",
+			path:                 "/release/my-app/beta",
+			licenseID:            "license-id",
+			expectedStatus:       http.StatusOK,
+			expectedSequence:     "1",
+			expectedVersionLabel: "",
+			expectedChannel:      "beta",
+			expectedFiles:        map[string]string{"deployment.yaml": "version: beta"},
+		},
+		{
+			name:                 "head of a channel named pending",
+			path:                 "/release/my-app/pending",
+			licenseID:            "license-id",
+			expectedStatus:       http.StatusOK,
+			expectedSequence:     "1",
+			expectedVersionLabel: "v2.0.0",
+			expectedChannel:      "pending",
+			expectedFiles:        map[string]string{"deployment.yaml": "version: pending"},
+		},
+		{
+			name:                 "pinned sequence",
+			path:                 "/release/my-app/stable?sequence=1",
+			licenseID:            "license-id",
+			expectedStatus:       http.StatusOK,
+			expectedSequence:     "1",
+			expectedVersionLabel: "v1.0.0",
+			expectedChannel:      "stable",
+			expectedFiles:        map[string]string{"deployment.yaml": "version: 1"},
+		},
+		{
+			name:                 "pinned version label",
+			path:                 "/release/my-app/stable?versionLabel=v1.1.0",
+			licenseID:            "license-id",
+			expectedStatus:       http.StatusOK,
+			expectedSequence:     "2",
+			expectedVersionLabel: "v1.1.0",
+			expectedChannel:      "stable",
+			expectedReleaseNotes: "Fixes the thing\n\nAnd another",
+			expectedFiles:        map[string]string{"deployment.yaml": "version: 2"},
+		},
+		{
+			name:           "unknown version label",
+			path:           "/release/my-app/stable?versionLabel=v2.0.0",
+			licenseID:      "license-id",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unknown license",
+			path:           "/release/my-app/stable",
+			licenseID:      "other-license-id",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "license for another app",
+			path:           "/release/other-app/stable",
+			licenseID:      "license-id",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			for _, method := range []string{http.MethodHead, http.MethodGet} {
+				r, err := http.NewRequest(method, httpServer.URL+test.path, nil)
+				req.NoError(err)
+				r.SetBasicAuth(test.licenseID, test.licenseID)
+
+				resp, err := http.DefaultClient.Do(r)
+				req.NoError(err)
+				defer resp.Body.Close()
+
+				req.Equal(test.expectedStatus, resp.StatusCode)
+				if test.expectedStatus != http.StatusOK {
+					continue
+				}
+
+				assert.Equal(t, test.expectedSequence, resp.Header.Get("X-Replicated-Sequence"))
+				assert.Equal(t, test.expectedVersionLabel, resp.Header.Get("X-Replicated-VersionLabel"))
+				assert.Equal(t, test.expectedChannel, resp.Header.Get("X-Replicated-ChannelName"))
+				assert.NotEmpty(t, resp.Header.Get("X-Replicated-ReleasedAt"))
+
+				releaseNotes, err := url.PathUnescape(resp.Header.Get("X-Replicated-ReleaseNotes"))
+				req.NoError(err)
+				assert.Equal(t, test.expectedReleaseNotes, releaseNotes)
+
+				if method == http.MethodGet {
+					assert.Equal(t, test.expectedFiles, mustReadTarGz(t, resp.Body))
+				}
+			}
+		})
+	}
+
+	resp, err := http.Get(httpServer.URL + "/metadata/my-app/stable")
+	req.NoError(err)
+	defer resp.Body.Close()
+	req.Equal(http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	req.NoError(err)
+	assert.Equal(t, application, string(body))
+
+	// the head of beta doesn't have an application
+	resp, err = http.Get(httpServer.URL + "/metadata/my-app/beta")
+	req.NoError(err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
 	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	kotslicense "github.com/replicatedhq/kots/pkg/license"
 	"k8s.io/client-go/kubernetes/scheme"
 )
 
@@ -43,31 +44,36 @@ func createUploadableArchive(rootPath string) (string, error) {
 	return path.Join(tempDir, "kots-uploadable-archive.tar.gz"), nil
 }
 
-func findUpdateCursor(rootPath string) (string, error) {
+// findInstallation returns the installation that was written when the app was
+// pulled, or nil if there isn't one
+func findInstallation(rootPath string) (*kotsv1beta1.Installation, error) {
 	installationFilePath := path.Join(rootPath, "upstream", "userdata", "installation.yaml")
 	_, err := os.Stat(installationFilePath)
 	if os.IsNotExist(err) {
-		return "", nil
+		return nil, nil
 	}
 	if err != nil {
-		return "", errors.Wrap(err, "failed to open file")
+		return nil, errors.Wrap(err, "failed to open file")
 	}
 
 	installationData, err := ioutil.ReadFile(installationFilePath)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to read update installation file")
+		return nil, errors.Wrap(err, "failed to read update installation file")
 	}
 
 	kotsscheme.AddToScheme(scheme.Scheme)
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 	obj, _, err := decode([]byte(installationData), nil, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to devode installation data")
+		return nil, errors.Wrap(err, "failed to devode installation data")
 	}
 
-	installation := obj.(*kotsv1beta1.Installation)
+	installation, ok := obj.(*kotsv1beta1.Installation)
+	if !ok {
+		return nil, errors.New("not an installation")
+	}
 
-	return installation.Spec.UpdateCursor, nil
+	return installation, nil
 }
 
 func findLicense(rootPath string) (*string, error) {
@@ -89,3 +95,12 @@ func findLicense(rootPath string) (*string, error) {
 	license := string(b)
 	return &license, nil
 }
+
+func verifyLicense(licenseData string, publicKeyFiles []string) error {
+	license, err := kotslicense.ParseLicense([]byte(licenseData))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse license")
+	}
+
+	return kotslicense.VerifyWithPublicKeyFiles(license, publicKeyFiles)
+}
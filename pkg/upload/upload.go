@@ -11,11 +11,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/manifoldco/promptui"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/httpclient"
 	"github.com/replicatedhq/kots/pkg/k8sutil"
 	"github.com/replicatedhq/kots/pkg/logger"
+	"github.com/replicatedhq/kots/pkg/upstream"
 	"github.com/replicatedhq/kots/pkg/util"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -24,14 +27,21 @@ import (
 )
 
 type UploadOptions struct {
-	Namespace       string
-	UpstreamURI     string
-	Kubeconfig      string
-	ExistingAppSlug string
-	NewAppName      string
-	VersionLabel    string
-	UpdateCursor    string
-	License         *string
+	Namespace               string
+	UpstreamURI             string
+	Kubeconfig              string
+	ExistingAppSlug         string
+	NewAppName              string
+	VersionLabel            string
+	UpdateCursor            string
+	ReleaseNotes            string
+	ReleasedAt              *time.Time
+	ChannelName             string
+	License                 *string
+	LicensePublicKeyFiles   []string
+	SkipVerify              bool
+	SkipLicenseVerification bool
+	HTTPClientOptions       httpclient.Options
 }
 
 func Upload(path string, uploadOptions UploadOptions) error {
@@ -39,18 +49,45 @@ func Upload(path string, uploadOptions UploadOptions) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to find license")
 	}
+	if license != nil && !uploadOptions.SkipLicenseVerification {
+		if err := verifyLicense(*license, uploadOptions.LicensePublicKeyFiles); err != nil {
+			return errors.Wrap(err, "failed to verify license")
+		}
+	}
 	uploadOptions.License = license
 
-	updateCursor, err := findUpdateCursor(path)
+	if !uploadOptions.SkipVerify {
+		diff, err := upstream.VerifyUpstream(path)
+		if err != nil && err != upstream.ErrNoChecksums {
+			return errors.Wrap(err, "failed to verify upstream")
+		}
+		if diff != nil && !diff.IsEmpty() {
+			return errors.Errorf("upstream files were changed after the app was pulled (%s), make changes in overlays instead or pass --skip-verify", diff)
+		}
+	}
+
+	installation, err := findInstallation(path)
 	if err != nil {
-		return errors.Wrap(err, "failed to find update cursor")
+		return errors.Wrap(err, "failed to find installation")
 	}
 
-	if updateCursor == "" {
+	if installation == nil || installation.Spec.UpdateCursor == "" {
 		return errors.New("no update cursor found. this is not yet supported")
 	}
 
-	uploadOptions.UpdateCursor = updateCursor
+	uploadOptions.UpdateCursor = installation.Spec.UpdateCursor
+	if uploadOptions.VersionLabel == "" {
+		uploadOptions.VersionLabel = installation.Spec.VersionLabel
+	}
+	if uploadOptions.UpstreamURI == "" {
+		uploadOptions.UpstreamURI = installation.Spec.UpstreamURI
+	}
+	uploadOptions.ReleaseNotes = installation.Spec.ReleaseNotes
+	uploadOptions.ChannelName = installation.Spec.ChannelName
+	if installation.Spec.ReleasedAt != nil {
+		releasedAt := installation.Spec.ReleasedAt.Time
+		uploadOptions.ReleasedAt = &releasedAt
+	}
 
 	archiveFilename, err := createUploadableArchive(path)
 	if err != nil {
@@ -116,7 +153,12 @@ func Upload(path string, uploadOptions UploadOptions) error {
 		log.FinishSpinnerWithError()
 		return errors.Wrap(err, "failed to create upload request")
 	}
-	resp, err := http.DefaultClient.Do(req)
+	client, err := httpclient.New(uploadOptions.HTTPClientOptions)
+	if err != nil {
+		log.FinishSpinnerWithError()
+		return errors.Wrap(err, "failed to create http client")
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		log.FinishSpinnerWithError()
 		return errors.Wrap(err, "failed to execute request")
@@ -198,6 +240,7 @@ func createUploadRequest(path string, uploadOptions UploadOptions, uri string) (
 			"versionLabel": uploadOptions.VersionLabel,
 			"updateCursor": uploadOptions.UpdateCursor,
 		}
+		addReleaseMetadata(metadata, uploadOptions)
 		b, err := json.Marshal(metadata)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to marshal json")
@@ -215,9 +258,10 @@ func createUploadRequest(path string, uploadOptions UploadOptions, uri string) (
 		body := map[string]string{
 			"name":         uploadOptions.NewAppName,
 			"versionLabel": uploadOptions.VersionLabel,
-			"upstreamURI":  uploadOptions.UpstreamURI,
+			"upstreamURI":  util.RemoveURLCredentials(uploadOptions.UpstreamURI),
 			"updateCursor": uploadOptions.UpdateCursor,
 		}
+		addReleaseMetadata(body, uploadOptions)
 
 		if uploadOptions.License != nil {
 			body["license"] = *uploadOptions.License
@@ -291,11 +335,6 @@ func promptForUpstreamURI() (string, error) {
 		Success: "{{ . | bold }} ",
 	}
 
-	supportedSchemes := map[string]interface{}{
-		"helm":       nil,
-		"replicated": nil,
-	}
-
 	prompt := promptui.Prompt{
 		Label:     "Upstream URI:",
 		Templates: templates,
@@ -309,8 +348,7 @@ func promptForUpstreamURI() (string, error) {
 				return errors.New("Invalid URL")
 			}
 
-			_, ok := supportedSchemes[u.Scheme]
-			if !ok {
+			if _, ok := upstream.GetProvider(u.Scheme); !ok {
 				return errors.New("Unsupported upstream type")
 			}
 
@@ -330,3 +368,17 @@ func promptForUpstreamURI() (string, error) {
 		return result, nil
 	}
 }
+
+// addReleaseMetadata adds the release metadata that was recorded when the app was
+// pulled, so the admin console can show it with the version
+func addReleaseMetadata(metadata map[string]string, uploadOptions UploadOptions) {
+	if uploadOptions.ReleaseNotes != "" {
+		metadata["releaseNotes"] = uploadOptions.ReleaseNotes
+	}
+	if uploadOptions.ReleasedAt != nil {
+		metadata["releasedAt"] = uploadOptions.ReleasedAt.UTC().Format(time.RFC3339)
+	}
+	if uploadOptions.ChannelName != "" {
+		metadata["channelName"] = uploadOptions.ChannelName
+	}
+}
@@ -7,14 +7,18 @@ import (
 	"net/http"
 
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/httpclient"
 	"github.com/replicatedhq/kots/pkg/k8sutil"
 	"github.com/replicatedhq/kots/pkg/logger"
 )
 
 type UploadLicenseOptions struct {
-	Namespace  string
-	Kubeconfig string
-	NewAppName string
+	Namespace               string
+	Kubeconfig              string
+	NewAppName              string
+	LicensePublicKeyFiles   []string
+	HTTPClientOptions       httpclient.Options
+	SkipLicenseVerification bool
 }
 
 func UploadLicense(path string, uploadLicenseOptions UploadLicenseOptions) error {
@@ -24,6 +28,12 @@ func UploadLicense(path string, uploadLicenseOptions UploadLicenseOptions) error
 	}
 	license := string(b)
 
+	if !uploadLicenseOptions.SkipLicenseVerification {
+		if err := verifyLicense(license, uploadLicenseOptions.LicensePublicKeyFiles); err != nil {
+			return errors.Wrap(err, "failed to verify license")
+		}
+	}
+
 	// Make sure we have a name or slug
 	if uploadLicenseOptions.NewAppName == "" {
 		appName, err := relentlesslyPromptForAppName("")
@@ -58,7 +68,12 @@ func UploadLicense(path string, uploadLicenseOptions UploadLicenseOptions) error
 		log.FinishSpinnerWithError()
 		return errors.Wrap(err, "failed to create upload request")
 	}
-	resp, err := http.DefaultClient.Do(req)
+	client, err := httpclient.New(uploadLicenseOptions.HTTPClientOptions)
+	if err != nil {
+		log.FinishSpinnerWithError()
+		return errors.Wrap(err, "failed to create http client")
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		log.FinishSpinnerWithError()
 		return errors.Wrap(err, "failed to execute request")
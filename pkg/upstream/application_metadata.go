@@ -0,0 +1,210 @@
+package upstream
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultReplicatedEndpoint is used when the license doesn't have an endpoint
+const DefaultReplicatedEndpoint = "https://replicated.app"
+
+// ApplicationMetadataFilename is where the application metadata is cached in the
+// upstream userdata, so that it's available for airgapped installs and updates
+const ApplicationMetadataFilename = "application-metadata.yaml"
+
+// maxIconSize is the largest icon that will be inlined into the metadata
+const maxIconSize = 1024 * 1024
+
+// GetApplicationMetadata will return any available application yaml from
+// the upstream, fetched from the endpoint in the license from the fetch options.
+// If there is no application.yaml, it will return a placeholder one
+func GetApplicationMetadata(upstream *url.URL, fetchOptions *FetchOptions) ([]byte, error) {
+	r, err := parseReplicatedURL(upstream)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse replicated upstream")
+	}
+
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := getApplicationMetadata(client, r, fetchOptions.License)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get application metadata")
+	}
+
+	if metadata == nil {
+		metadata = []byte(DefaultMetadata)
+	}
+
+	return metadata, nil
+}
+
+// ReadApplicationMetadata returns the application metadata that was cached when the
+// app was pulled into the app dir, or nil if there isn't any
+func ReadApplicationMetadata(appDir string) ([]byte, error) {
+	metadata, err := ioutil.ReadFile(path.Join(appDir, "upstream", "userdata", ApplicationMetadataFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read application metadata")
+	}
+
+	return metadata, nil
+}
+
+// getApplicationMetadata fetches the application metadata for the upstream from the
+// license endpoint, with the icon inlined. Nil is returned if the app has no metadata.
+func getApplicationMetadata(client *http.Client, r *ReplicatedUpstream, license *kotsv1beta1.License) ([]byte, error) {
+	endpoint := DefaultReplicatedEndpoint
+	if license != nil && license.Spec.Endpoint != "" {
+		endpoint = license.Spec.Endpoint
+	}
+
+	metadataURL := fmt.Sprintf("%s/metadata/%s", strings.TrimSuffix(endpoint, "/"), r.AppSlug)
+	if r.Channel != nil {
+		metadataURL = fmt.Sprintf("%s/%s", metadataURL, *r.Channel)
+	}
+
+	getReq, err := http.NewRequest("GET", metadataURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call newrequest")
+	}
+
+	getResp, err := client.Do(getReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute get request")
+	}
+	defer getResp.Body.Close()
+
+	if getResp.StatusCode == 404 {
+		// no metadata is not an error
+		return nil, nil
+	}
+
+	if getResp.StatusCode >= 400 {
+		return nil, errors.Errorf("expected result from get request: %d", getResp.StatusCode)
+	}
+
+	metadata, err := ioutil.ReadAll(getResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata")
+	}
+
+	application, err := parseApplicationMetadata(metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse metadata")
+	}
+
+	icon, err := inlineIcon(client, application.Spec.Icon)
+	if err != nil {
+		// the icon is only branding, it's not worth failing the install over
+		return metadata, nil
+	}
+	if icon == application.Spec.Icon {
+		return metadata, nil
+	}
+
+	metadata, err = replaceApplicationIcon(metadata, icon)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to replace icon")
+	}
+
+	return metadata, nil
+}
+
+// parseApplicationMetadata returns the metadata as an application, or an error if
+// it's not a valid application
+func parseApplicationMetadata(metadata []byte) (*kotsv1beta1.Application, error) {
+	kotsscheme.AddToScheme(scheme.Scheme)
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, gvk, err := decode(metadata, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode metadata")
+	}
+
+	if gvk.Group != "kots.io" || gvk.Version != "v1beta1" || gvk.Kind != "Application" {
+		return nil, errors.Errorf("metadata is a %s, not an application", gvk.String())
+	}
+
+	application := obj.(*kotsv1beta1.Application)
+	if application.Spec.Title == "" {
+		return nil, errors.New("application has no title")
+	}
+
+	return application, nil
+}
+
+// inlineIcon downloads the icon and returns it as a data uri. Icons that are not
+// http urls are returned as they are.
+func inlineIcon(client *http.Client, icon string) (string, error) {
+	if !strings.HasPrefix(icon, "http://") && !strings.HasPrefix(icon, "https://") {
+		return icon, nil
+	}
+
+	resp, err := client.Get(icon)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get icon")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", errors.Errorf("unexpected status code getting icon: %d", resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIconSize+1))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read icon")
+	}
+	if len(content) > maxIconSize {
+		return "", errors.Errorf("icon is larger than %d bytes", maxIconSize)
+	}
+
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(contentType, "image/") {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(content))
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", errors.Errorf("icon is %s, not an image", contentType)
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(content)), nil
+}
+
+// replaceApplicationIcon sets the icon in the application yaml, keeping the rest of
+// the document as it is
+func replaceApplicationIcon(metadata []byte, icon string) ([]byte, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(metadata, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal metadata")
+	}
+
+	spec, ok := doc["spec"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata has no spec")
+	}
+	spec["icon"] = icon
+
+	updated, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal metadata")
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,125 @@
+package upstream
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GetApplicationMetadata(t *testing.T) {
+	icon := []byte("\x89PNG\r\n\x1a\n0000")
+
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/app-slug/stable":
+			w.Write([]byte(`apiVersion: kots.io/v1beta1
+kind: Application
+metadata:
+  name: app-slug
+spec:
+  title: My App
+  icon: ` + serverURL + `/icon.png`))
+		case "/metadata/app-slug/broken-icon":
+			w.Write([]byte(`apiVersion: kots.io/v1beta1
+kind: Application
+metadata:
+  name: app-slug
+spec:
+  title: My App
+  icon: ` + serverURL + `/missing.png`))
+		case "/metadata/app-slug/not-an-app":
+			w.Write([]byte(`apiVersion: kots.io/v1beta1
+kind: Config
+metadata:
+  name: app-slug`))
+		case "/icon.png":
+			w.Write(icon)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	license := &kotsv1beta1.License{
+		Spec: kotsv1beta1.LicenseSpec{
+			AppSlug:   "app-slug",
+			Endpoint:  server.URL,
+			LicenseID: "license-id",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		uri          string
+		expectedIcon string
+		expectErr    bool
+	}{
+		{
+			name:         "icon is inlined",
+			uri:          "replicated://app-slug/stable",
+			expectedIcon: "data:image/png;base64," + base64.StdEncoding.EncodeToString(icon),
+		},
+		{
+			name:         "icon can't be downloaded",
+			uri:          "replicated://app-slug/broken-icon",
+			expectedIcon: server.URL + "/missing.png",
+		},
+		{
+			name:         "no metadata",
+			uri:          "replicated://app-slug/beta",
+			expectedIcon: "https://cdn1.iconfinder.com/data/icons/ninja-things-1/1772/ninja-simple-512.png",
+		},
+		{
+			name:      "not an application",
+			uri:       "replicated://app-slug/not-an-app",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			u, err := url.ParseRequestURI(test.uri)
+			req.NoError(err)
+
+			metadata, err := GetApplicationMetadata(u, &FetchOptions{License: license})
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+
+			application, err := parseApplicationMetadata(metadata)
+			req.NoError(err)
+			assert.Equal(t, test.expectedIcon, application.Spec.Icon)
+		})
+	}
+}
+
+func Test_replaceApplicationIcon(t *testing.T) {
+	req := require.New(t)
+
+	metadata := []byte(`apiVersion: kots.io/v1beta1
+kind: Application
+metadata:
+  name: app-slug
+spec:
+  title: My App
+  icon: https://example.com/icon.png
+  releaseNotes: keep me
+`)
+
+	updated, err := replaceApplicationIcon(metadata, "data:image/png;base64,AAAA")
+	req.NoError(err)
+	assert.Contains(t, string(updated), "icon: data:image/png;base64,AAAA")
+	assert.Contains(t, string(updated), "releaseNotes: keep me")
+}
@@ -0,0 +1,180 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// ChecksumsFilename is the file in upstream/userdata with the checksums of the
+// upstream files, written with the installation
+const ChecksumsFilename = "checksums.yaml"
+
+// ErrNoChecksums is returned by VerifyUpstream when the app was pulled before
+// checksums were written
+var ErrNoChecksums = errors.New("no upstream checksums found")
+
+// Checksums are the sha256 checksums of the files that were written to the upstream
+// dir, keyed by their path in the dir. Files in userdata are meant to be edited, so
+// they are not included.
+type Checksums struct {
+	UpdateCursor string            `json:"updateCursor"`
+	Files        map[string]string `json:"files"`
+}
+
+// ChecksumDiff lists the upstream files that don't match the checksums
+type ChecksumDiff struct {
+	Modified []string `json:"modified,omitempty"`
+	Missing  []string `json:"missing,omitempty"`
+	Extra    []string `json:"extra,omitempty"`
+}
+
+// IsEmpty returns true when the upstream files match the checksums
+func (d *ChecksumDiff) IsEmpty() bool {
+	return len(d.Modified) == 0 && len(d.Missing) == 0 && len(d.Extra) == 0
+}
+
+func (d *ChecksumDiff) String() string {
+	parts := []string{}
+	if len(d.Modified) > 0 {
+		parts = append(parts, fmt.Sprintf("modified: %s", strings.Join(d.Modified, ", ")))
+	}
+	if len(d.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing: %s", strings.Join(d.Missing, ", ")))
+	}
+	if len(d.Extra) > 0 {
+		parts = append(parts, fmt.Sprintf("extra: %s", strings.Join(d.Extra, ", ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func newChecksums(updateCursor string, files []UpstreamFile) *Checksums {
+	checksums := &Checksums{
+		UpdateCursor: updateCursor,
+		Files:        map[string]string{},
+	}
+
+	for _, file := range files {
+		filePath := path.Clean(file.Path)
+		if isUserdataPath(filePath) {
+			continue
+		}
+		checksums.Files[filePath] = sha256Hex(file.Content)
+	}
+
+	return checksums
+}
+
+func writeChecksums(renderDir string, checksums *Checksums) error {
+	b, err := yaml.Marshal(checksums)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal checksums")
+	}
+
+	if err := ioutil.WriteFile(path.Join(renderDir, "userdata", ChecksumsFilename), b, 0644); err != nil {
+		return errors.Wrap(err, "failed to write checksums")
+	}
+
+	return nil
+}
+
+// ReadChecksums returns the checksums that were written with the upstream when the
+// app was pulled into the app dir, or ErrNoChecksums if there are none
+func ReadChecksums(appDir string) (*Checksums, error) {
+	b, err := ioutil.ReadFile(path.Join(appDir, "upstream", "userdata", ChecksumsFilename))
+	if os.IsNotExist(err) {
+		return nil, ErrNoChecksums
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read checksums")
+	}
+
+	checksums := Checksums{}
+	if err := yaml.Unmarshal(b, &checksums); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal checksums")
+	}
+
+	return &checksums, nil
+}
+
+// VerifyUpstream compares the files in the upstream dir of the app dir to the
+// checksums that were written when it was pulled. Only the upstream dir is checked,
+// base and overlays are free to change.
+func VerifyUpstream(appDir string) (*ChecksumDiff, error) {
+	checksums, err := ReadChecksums(appDir)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamDir := path.Join(appDir, "upstream")
+	found := map[string]bool{}
+	diff := ChecksumDiff{}
+
+	err = filepath.Walk(upstreamDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(upstreamDir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if info.IsDir() {
+			if isUserdataPath(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		checksum, ok := checksums.Files[relPath]
+		if !ok {
+			diff.Extra = append(diff.Extra, relPath)
+			return nil
+		}
+		found[relPath] = true
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if sha256Hex(content) != checksum {
+			diff.Modified = append(diff.Modified, relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk upstream dir")
+	}
+
+	for filePath := range checksums.Files {
+		if !found[filePath] {
+			diff.Missing = append(diff.Missing, filePath)
+		}
+	}
+
+	sort.Strings(diff.Modified)
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Extra)
+
+	return &diff, nil
+}
+
+func isUserdataPath(filePath string) bool {
+	return filePath == "userdata" || strings.HasPrefix(filePath, "userdata/")
+}
+
+func sha256Hex(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
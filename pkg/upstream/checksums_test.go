@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_VerifyUpstream(t *testing.T) {
+	files := []UpstreamFile{
+		{Path: "deployment.yaml", Content: []byte("kind: Deployment")},
+		{Path: "manifests/service.yaml", Content: []byte("kind: Service")},
+		{Path: "userdata/config.yaml", Content: []byte("kind: ConfigValues")},
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(upstreamDir string) error
+		expected ChecksumDiff
+	}{
+		{
+			name:     "unchanged",
+			modify:   func(upstreamDir string) error { return nil },
+			expected: ChecksumDiff{},
+		},
+		{
+			name: "modified file",
+			modify: func(upstreamDir string) error {
+				return ioutil.WriteFile(filepath.Join(upstreamDir, "manifests", "service.yaml"), []byte("kind: Ingress"), 0644)
+			},
+			expected: ChecksumDiff{Modified: []string{"manifests/service.yaml"}},
+		},
+		{
+			name: "missing file",
+			modify: func(upstreamDir string) error {
+				return os.Remove(filepath.Join(upstreamDir, "deployment.yaml"))
+			},
+			expected: ChecksumDiff{Missing: []string{"deployment.yaml"}},
+		},
+		{
+			name: "extra file",
+			modify: func(upstreamDir string) error {
+				return ioutil.WriteFile(filepath.Join(upstreamDir, "manifests", "secret.yaml"), []byte("kind: Secret"), 0644)
+			},
+			expected: ChecksumDiff{Extra: []string{"manifests/secret.yaml"}},
+		},
+		{
+			name: "userdata and overlays can change",
+			modify: func(upstreamDir string) error {
+				if err := ioutil.WriteFile(filepath.Join(upstreamDir, "userdata", "config.yaml"), []byte("changed"), 0644); err != nil {
+					return err
+				}
+				if err := ioutil.WriteFile(filepath.Join(upstreamDir, "userdata", "values.yaml"), []byte("added"), 0644); err != nil {
+					return err
+				}
+				overlaysDir := filepath.Join(upstreamDir, "..", "overlays", "midstream")
+				if err := os.MkdirAll(overlaysDir, 0755); err != nil {
+					return err
+				}
+				return ioutil.WriteFile(filepath.Join(overlaysDir, "kustomization.yaml"), []byte("bases: []"), 0644)
+			},
+			expected: ChecksumDiff{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			appDir, err := ioutil.TempDir("", "kots")
+			req.NoError(err)
+			defer os.RemoveAll(appDir)
+
+			upstreamDir := filepath.Join(appDir, "upstream")
+			for _, file := range files {
+				filePath := filepath.Join(upstreamDir, file.Path)
+				req.NoError(os.MkdirAll(filepath.Dir(filePath), 0755))
+				req.NoError(ioutil.WriteFile(filePath, file.Content, 0644))
+			}
+			req.NoError(writeChecksums(upstreamDir, newChecksums("42", files)))
+
+			checksums, err := ReadChecksums(appDir)
+			req.NoError(err)
+			assert.Equal(t, "42", checksums.UpdateCursor)
+			assert.Len(t, checksums.Files, 2)
+
+			req.NoError(test.modify(upstreamDir))
+
+			diff, err := VerifyUpstream(appDir)
+			req.NoError(err)
+			assert.Equal(t, test.expected, *diff)
+			assert.Equal(t, len(test.expected.Modified)+len(test.expected.Missing)+len(test.expected.Extra) == 0, diff.IsEmpty())
+		})
+	}
+}
+
+func Test_VerifyUpstreamNoChecksums(t *testing.T) {
+	req := require.New(t)
+
+	appDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(appDir)
+
+	_, err = VerifyUpstream(appDir)
+	assert.Equal(t, ErrNoChecksums, err)
+}
@@ -1,18 +1,56 @@
 package upstream
 
 import (
+	"net/http"
 	"net/url"
 
 	"github.com/pkg/errors"
 	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/httpclient"
 	"github.com/replicatedhq/kots/pkg/util"
 )
 
 type FetchOptions struct {
-	HelmRepoName string
-	HelmRepoURI  string
-	LocalPath    string
-	License      *kotsv1beta1.License
+	HelmRepoName               string
+	HelmRepoURI                string
+	HelmRepoUsername           string
+	HelmRepoPassword           string
+	HelmRepoCertFile           string
+	HelmRepoKeyFile            string
+	HelmRepoCAFile             string
+	HelmRepoInsecureSkipVerify bool
+	HelmIncludePrereleases     bool
+	HelmReposFile              string
+	LocalPath                  string
+	License                    *kotsv1beta1.License
+	CacheDir                   string
+	Offline                    bool
+	HTTPClientOptions          httpclient.Options
+
+	httpClient *http.Client
+}
+
+// includePrereleases returns true if prerelease versions can be resolved to
+func (o *FetchOptions) includePrereleases() bool {
+	return o != nil && o.HelmIncludePrereleases
+}
+
+// getHTTPClient returns the client that requests for the upstream are made with,
+// created from the http client options the first time it's needed
+func (o *FetchOptions) getHTTPClient() (*http.Client, error) {
+	if o == nil {
+		return httpclient.New(httpclient.Options{})
+	}
+
+	if o.httpClient == nil {
+		client, err := httpclient.New(o.HTTPClientOptions)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create http client")
+		}
+		o.httpClient = client
+	}
+
+	return o.httpClient, nil
 }
 
 func FetchUpstream(upstreamURI string, fetchOptions *FetchOptions) (*Upstream, error) {
@@ -24,27 +62,68 @@ func FetchUpstream(upstreamURI string, fetchOptions *FetchOptions) (*Upstream, e
 	return upstream, nil
 }
 
-func downloadUpstream(upstreamURI string, fetchOptions *FetchOptions) (*Upstream, error) {
+// CanFetchUpstream returns true if the provider for the upstream uri is able
+// to fetch it with the fetch options provided
+func CanFetchUpstream(upstreamURI string, fetchOptions *FetchOptions) (bool, error) {
+	upstreamURI = kustomizeRemoteTargetURI(upstreamURI)
 	if !util.IsURL(upstreamURI) {
-		return readFilesFromPath(upstreamURI)
+		return true, nil
 	}
 
-	u, err := url.ParseRequestURI(upstreamURI)
+	u, provider, err := getProviderForURI(upstreamURI)
 	if err != nil {
-		return nil, errors.Wrap(err, "parse request uri failed")
+		return false, err
 	}
-	if u.Scheme == "helm" {
-		return downloadHelm(u, fetchOptions.HelmRepoURI)
+
+	if fetchOptions == nil {
+		fetchOptions = &FetchOptions{}
 	}
-	if u.Scheme == "replicated" {
-		return downloadReplicated(u, fetchOptions.LocalPath, fetchOptions.License)
+
+	return provider.CanFetch(u, fetchOptions)
+}
+
+func downloadUpstream(upstreamURI string, fetchOptions *FetchOptions) (*Upstream, error) {
+	upstreamURI = kustomizeRemoteTargetURI(upstreamURI)
+
+	var upstream *Upstream
+	if !util.IsURL(upstreamURI) {
+		u, err := readFilesFromPath(upstreamURI)
+		if err != nil {
+			return nil, err
+		}
+		upstream = u
+	} else {
+		u, provider, err := getProviderForURI(upstreamURI)
+		if err != nil {
+			return nil, err
+		}
+
+		if fetchOptions == nil {
+			fetchOptions = &FetchOptions{}
+		}
+
+		fetched, err := provider.Fetch(u, fetchOptions)
+		if err != nil {
+			return nil, err
+		}
+		upstream = fetched
 	}
-	if u.Scheme == "git" {
-		return downloadGit(upstreamURI)
+
+	applyChartMetadata(upstream)
+
+	return upstream, nil
+}
+
+func getProviderForURI(upstreamURI string) (*url.URL, Provider, error) {
+	u, err := url.ParseRequestURI(upstreamURI)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse request uri failed")
 	}
-	if u.Scheme == "http" || u.Scheme == "https" {
-		return downloadHttp(upstreamURI)
+
+	provider, ok := GetProvider(u.Scheme)
+	if !ok {
+		return nil, nil, errors.Errorf("unknown protocol scheme %q", u.Scheme)
 	}
 
-	return nil, errors.Errorf("unknown protocol scheme %q", u.Scheme)
+	return u, provider, nil
 }
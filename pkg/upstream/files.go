@@ -1,13 +1,236 @@
 package upstream
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
-func readFilesFromPath(filepath string) (*Upstream, error) {
-	return nil, errors.New("not implemented")
+// readFilesFromPath creates an upstream from a local directory of yaml, a local
+// chart directory, a local kustomization, a packaged chart (.tgz) or a single yaml
+// file. The update cursor is a hash of the content, so any change to the files is
+// considered an update.
+func readFilesFromPath(localPath string) (*Upstream, error) {
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get absolute path")
+	}
+
+	fi, err := os.Stat(absPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat path")
+	}
+
+	var files []UpstreamFile
+	name := filepath.Base(absPath)
+
+	if fi.IsDir() && isKustomizationDir(absPath) {
+		return buildKustomizeUpstream(absPath, name)
+	}
+
+	if fi.IsDir() {
+		f, err := readFilesFromDir(absPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read files from dir")
+		}
+		files = f
+	} else if isTarGzFilename(absPath) {
+		f, err := readTarGz(absPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read archive")
+		}
+		files = f
+		name = trimArchiveExtension(name)
+	} else {
+		content, err := ioutil.ReadFile(absPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read file")
+		}
+		files = []UpstreamFile{
+			{
+				Path:    filepath.Base(absPath),
+				Content: content,
+			},
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	if len(files) == 0 {
+		return nil, errors.Errorf("no files found in %s", localPath)
+	}
+
+	upstreamType := upstreamTypeFromFiles(files)
+	if upstreamType == "helm" {
+		if chartName := chartNameFromFiles(files); chartName != "" {
+			name = chartName
+		}
+	}
+
+	upstream := &Upstream{
+		URI:          absPath,
+		Name:         name,
+		Type:         upstreamType,
+		Files:        files,
+		UpdateCursor: contentHash(files),
+	}
+
+	return upstream, nil
 }
 
 func readFilesFromURI(upstreamURI string) (*Upstream, error) {
 	return nil, errors.New("not implemented")
 }
+
+func readFilesFromDir(root string) ([]UpstreamFile, error) {
+	upstreamFiles := []UpstreamFile{}
+
+	err := filepath.Walk(root,
+		func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			contents, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(root, filePath)
+			if err != nil {
+				return err
+			}
+
+			upstreamFiles = append(upstreamFiles, UpstreamFile{
+				Path:    filepath.ToSlash(relPath),
+				Content: contents,
+			})
+
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk dir")
+	}
+
+	return upstreamFiles, nil
+}
+
+// upstreamTypeFromFiles returns "helm" for a chart and "plain" for everything else
+func upstreamTypeFromFiles(files []UpstreamFile) string {
+	for _, file := range files {
+		if file.Path == "Chart.yaml" {
+			return "helm"
+		}
+	}
+
+	return "plain"
+}
+
+// chartMetadata is the part of Chart.yaml that is recorded with the upstream
+type chartMetadata struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	AppVersion  string `yaml:"appVersion"`
+	Description string `yaml:"description"`
+}
+
+// chartMetadataFromFiles returns the metadata in the top level Chart.yaml, or nil if
+// there is no Chart.yaml or it can't be parsed
+func chartMetadataFromFiles(files []UpstreamFile) *chartMetadata {
+	for _, file := range files {
+		if file.Path != "Chart.yaml" {
+			continue
+		}
+
+		metadata := chartMetadata{}
+		if err := yaml.Unmarshal(file.Content, &metadata); err != nil {
+			return nil
+		}
+
+		return &metadata
+	}
+
+	return nil
+}
+
+func chartNameFromFiles(files []UpstreamFile) string {
+	metadata := chartMetadataFromFiles(files)
+	if metadata == nil {
+		return ""
+	}
+
+	return metadata.Name
+}
+
+// applyChartMetadata uses the chart's appVersion as the version label and its
+// description as the release notes of helm upstreams, when the provider didn't
+// find better ones
+func applyChartMetadata(u *Upstream) {
+	if u.Type != "helm" {
+		return
+	}
+
+	metadata := chartMetadataFromFiles(u.Files)
+	if metadata == nil {
+		return
+	}
+
+	if u.VersionLabel == "" {
+		u.VersionLabel = metadata.AppVersion
+	}
+	if u.VersionLabel == "" {
+		u.VersionLabel = metadata.Version
+	}
+	if u.ReleaseNotes == "" {
+		u.ReleaseNotes = metadata.Description
+	}
+}
+
+// contentHash returns a stable sha256 of the paths and contents of all files
+func contentHash(files []UpstreamFile) string {
+	sortedFiles := make([]UpstreamFile, len(files))
+	copy(sortedFiles, files)
+	sort.Slice(sortedFiles, func(i, j int) bool {
+		return sortedFiles[i].Path < sortedFiles[j].Path
+	})
+
+	h := sha256.New()
+	for _, file := range sortedFiles {
+		fmt.Fprintf(h, "%s\x00%d\x00", file.Path, len(file.Content))
+		h.Write(file.Content)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func isTarGzFilename(filename string) bool {
+	lowerFilename := strings.ToLower(filename)
+	return strings.HasSuffix(lowerFilename, ".tgz") || strings.HasSuffix(lowerFilename, ".tar.gz")
+}
+
+func trimArchiveExtension(filename string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip", ".yaml", ".yml"} {
+		if strings.HasSuffix(strings.ToLower(filename), ext) {
+			return filename[:len(filename)-len(ext)]
+		}
+	}
+
+	return filename
+}
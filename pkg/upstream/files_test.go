@@ -0,0 +1,155 @@
+package upstream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readFilesFromPath(t *testing.T) {
+	req := require.New(t)
+
+	workDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(workDir)
+
+	manifestsDir := filepath.Join(workDir, "my-app")
+	req.NoError(os.MkdirAll(filepath.Join(manifestsDir, "web"), 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(manifestsDir, "web", "deployment.yaml"), []byte("kind: Deployment"), 0644))
+	req.NoError(ioutil.WriteFile(filepath.Join(manifestsDir, "service.yaml"), []byte("kind: Service"), 0644))
+
+	chartDir := filepath.Join(workDir, "chart-dir")
+	req.NoError(os.MkdirAll(filepath.Join(chartDir, "templates"), 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: redis\nversion: 1.0.0"), 0644))
+	req.NoError(ioutil.WriteFile(filepath.Join(chartDir, "templates", "service.yaml"), []byte("kind: Service"), 0644))
+
+	chartArchive := filepath.Join(workDir, "redis-1.0.0.tgz")
+	req.NoError(ioutil.WriteFile(chartArchive, mustCreateTarGz(t, map[string]string{
+		"redis/Chart.yaml":             "name: redis\nversion: 1.0.0",
+		"redis/templates/service.yaml": "kind: Service",
+	}), 0644))
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedName  string
+		expectedType  string
+		expectedFiles []UpstreamFile
+	}{
+		{
+			name:         "directory of yaml",
+			path:         manifestsDir,
+			expectedName: "my-app",
+			expectedType: "plain",
+			expectedFiles: []UpstreamFile{
+				{Path: "web/deployment.yaml", Content: []byte("kind: Deployment")},
+				{Path: "service.yaml", Content: []byte("kind: Service")},
+			},
+		},
+		{
+			name:         "chart directory",
+			path:         chartDir,
+			expectedName: "redis",
+			expectedType: "helm",
+			expectedFiles: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0")},
+				{Path: "templates/service.yaml", Content: []byte("kind: Service")},
+			},
+		},
+		{
+			name:         "packaged chart",
+			path:         chartArchive,
+			expectedName: "redis",
+			expectedType: "helm",
+			expectedFiles: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0")},
+				{Path: "templates/service.yaml", Content: []byte("kind: Service")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			upstream, err := readFilesFromPath(test.path)
+			req.NoError(err)
+			assert.Equal(t, test.expectedName, upstream.Name)
+			assert.Equal(t, test.expectedType, upstream.Type)
+			assert.ElementsMatch(t, test.expectedFiles, upstream.Files)
+			assert.Equal(t, contentHash(test.expectedFiles), upstream.UpdateCursor)
+		})
+	}
+}
+
+func Test_contentHash(t *testing.T) {
+	files := []UpstreamFile{
+		{Path: "a.yaml", Content: []byte("a")},
+		{Path: "b.yaml", Content: []byte("b")},
+	}
+	reordered := []UpstreamFile{files[1], files[0]}
+	changed := []UpstreamFile{
+		{Path: "a.yaml", Content: []byte("a")},
+		{Path: "b.yaml", Content: []byte("c")},
+	}
+
+	assert.Equal(t, contentHash(files), contentHash(reordered))
+	assert.NotEqual(t, contentHash(files), contentHash(changed))
+}
+
+func Test_applyChartMetadata(t *testing.T) {
+	tests := []struct {
+		name                 string
+		upstream             *Upstream
+		expectedVersionLabel string
+		expectedReleaseNotes string
+	}{
+		{
+			name: "app version and description",
+			upstream: &Upstream{
+				Type:  "helm",
+				Files: []UpstreamFile{{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0\nappVersion: 5.0.5\ndescription: An in-memory database")}},
+			},
+			expectedVersionLabel: "5.0.5",
+			expectedReleaseNotes: "An in-memory database",
+		},
+		{
+			name: "chart version when there is no app version",
+			upstream: &Upstream{
+				Type:  "helm",
+				Files: []UpstreamFile{{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0")}},
+			},
+			expectedVersionLabel: "1.0.0",
+		},
+		{
+			name: "provider metadata is kept",
+			upstream: &Upstream{
+				Type:         "helm",
+				VersionLabel: "v1.0.0",
+				ReleaseNotes: "First release",
+				Files:        []UpstreamFile{{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0\nappVersion: 5.0.5\ndescription: An in-memory database")}},
+			},
+			expectedVersionLabel: "v1.0.0",
+			expectedReleaseNotes: "First release",
+		},
+		{
+			name: "not a chart",
+			upstream: &Upstream{
+				Type:  "plain",
+				Files: []UpstreamFile{{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0")}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applyChartMetadata(test.upstream)
+			assert.Equal(t, test.expectedVersionLabel, test.upstream.VersionLabel)
+			assert.Equal(t, test.expectedReleaseNotes, test.upstream.ReleaseNotes)
+		})
+	}
+}
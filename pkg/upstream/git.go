@@ -1,9 +1,351 @@
 package upstream
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/util"
 )
 
-func downloadGit(gitURI string) (*Upstream, error) {
-	return nil, errors.New("not implemented")
+type gitProvider struct{}
+
+func (gitProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	return true, nil
+}
+
+func (gitProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	return downloadGit(u)
+}
+
+func (p gitProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	return checkForUpdatesByListing(p, u, currentCursor, fetchOptions)
+}
+
+// ListUpdates returns the newer semver tags when the uri is pinned to a semver tag,
+// and otherwise the commits that have been made to the ref since the current commit
+func (gitProvider) ListUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) ([]Update, error) {
+	repoURI, _, ref, err := parseGitURL(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse git uri")
+	}
+
+	remoteRefs, err := listGitRemoteRefs(repoURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list remote refs")
+	}
+
+	if _, isTag := remoteRefs["refs/tags/"+ref]; isTag {
+		if currentVersion, err := semver.NewVersion(ref); err == nil {
+			return newerGitTags(remoteRefs, currentVersion), nil
+		}
+	}
+
+	headSHA := ""
+	for _, refName := range []string{"refs/heads/" + ref, "refs/tags/" + ref} {
+		if sha, ok := remoteRefs[refName]; ok {
+			headSHA = sha
+			break
+		}
+	}
+	if ref == "" {
+		headSHA = remoteRefs["HEAD"]
+	}
+	if headSHA == "" {
+		if gitCommitSHARegex.MatchString(ref) {
+			// pinned to a commit
+			return []Update{}, nil
+		}
+		return nil, errors.Errorf("ref %q not found", ref)
+	}
+
+	if headSHA == currentCursor {
+		return []Update{}, nil
+	}
+
+	updates, err := listGitCommits(repoURI, currentCursor, headSHA)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list commits")
+	}
+	for i := range updates {
+		updates[i].VersionLabel = ref
+	}
+
+	return updates, nil
+}
+
+func downloadGit(u *url.URL) (*Upstream, error) {
+	repoURI, subPath, ref, err := parseGitURL(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse git uri")
+	}
+
+	cloneDir, err := ioutil.TempDir("", "kots")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary clone dir")
+	}
+	defer os.RemoveAll(cloneDir)
+
+	if _, err := runGit("", "clone", "--quiet", repoURI, cloneDir); err != nil {
+		return nil, errors.Wrap(err, "failed to clone repo")
+	}
+
+	if ref != "" {
+		if _, err := runGit(cloneDir, "checkout", "--quiet", ref); err != nil {
+			return nil, errors.Wrapf(err, "failed to checkout ref %q", ref)
+		}
+	}
+
+	commitSHA, err := runGit(cloneDir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get commit sha")
+	}
+
+	releaseNotes, releasedAt, err := gitReleaseMetadata(cloneDir, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get release metadata")
+	}
+
+	files, err := readFilesFromDir(filepath.Join(cloneDir, subPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read files from repo")
+	}
+
+	if len(files) == 0 {
+		return nil, errors.Errorf("no files found in %q", subPath)
+	}
+
+	upstream := &Upstream{
+		URI:          util.RemoveURLCredentials(u.String()),
+		Name:         gitRepoName(repoURI),
+		Type:         upstreamTypeFromFiles(files),
+		Files:        files,
+		UpdateCursor: commitSHA,
+		VersionLabel: ref,
+		ReleaseNotes: releaseNotes,
+		ReleasedAt:   releasedAt,
+	}
+
+	return upstream, nil
+}
+
+// parseGitURL splits a git upstream uri into the repo to clone, the subdirectory
+// in the repo to read and the ref to check out. The subdirectory is separated from
+// the repo with a double slash (git://host/org/repo//path/to/manifests?ref=v1.2.0).
+// When no host is present, the repo is read from the local filesystem.
+func parseGitURL(u *url.URL) (string, string, string, error) {
+	repoPath := u.Path
+	subPath := ""
+
+	if idx := strings.Index(u.Path, "//"); idx != -1 {
+		repoPath = u.Path[:idx]
+		subPath = u.Path[idx+2:]
+	}
+
+	if strings.Trim(repoPath, "/") == "" {
+		return "", "", "", errors.New("no repo path in uri")
+	}
+
+	subPath = path.Clean("/" + subPath)
+	subPath = strings.TrimPrefix(subPath, "/")
+
+	ref := u.Query().Get("ref")
+	if strings.HasPrefix(ref, "-") {
+		// git would parse the ref as an option
+		return "", "", "", errors.Errorf("invalid ref %q", ref)
+	}
+
+	if u.Host == "" {
+		return repoPath, subPath, ref, nil
+	}
+
+	repoURL := url.URL{
+		Scheme: u.Scheme,
+		User:   u.User,
+		Host:   u.Host,
+		Path:   repoPath,
+	}
+
+	return repoURL.String(), subPath, ref, nil
+}
+
+var gitCommitSHARegex = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// listGitRemoteRefs returns the commit of each ref in the remote repo. Annotated tags
+// are peeled to the commit that they point to.
+func listGitRemoteRefs(repoURI string) (map[string]string, error) {
+	out, err := runGit("", "ls-remote", repoURI)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		sha, refName := fields[0], fields[1]
+		if strings.HasSuffix(refName, "^{}") {
+			refs[strings.TrimSuffix(refName, "^{}")] = sha
+			continue
+		}
+		if _, ok := refs[refName]; !ok {
+			refs[refName] = sha
+		}
+	}
+
+	return refs, nil
+}
+
+// newerGitTags returns the semver tags that are newer than the current version,
+// oldest first
+func newerGitTags(remoteRefs map[string]string, currentVersion *semver.Version) []Update {
+	versions := []*semver.Version{}
+	for refName := range remoteRefs {
+		if !strings.HasPrefix(refName, "refs/tags/") {
+			continue
+		}
+
+		v, err := semver.NewVersion(strings.TrimPrefix(refName, "refs/tags/"))
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+
+		if v.GreaterThan(currentVersion) {
+			versions = append(versions, v)
+		}
+	}
+
+	sort.Sort(semver.Collection(versions))
+
+	updates := []Update{}
+	for _, v := range versions {
+		updates = append(updates, Update{
+			Cursor:       remoteRefs["refs/tags/"+v.Original()],
+			VersionLabel: v.Original(),
+		})
+	}
+
+	return updates
+}
+
+// listGitCommits returns the commits after fromSHA up to and including toSHA, oldest
+// first, with the commit subjects as the release notes. If fromSHA is not an ancestor
+// of toSHA (the history was rewritten), only toSHA is returned.
+func listGitCommits(repoURI string, fromSHA string, toSHA string) ([]Update, error) {
+	cloneDir, err := ioutil.TempDir("", "kots")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary clone dir")
+	}
+	defer os.RemoveAll(cloneDir)
+
+	// only the history is needed, not the files
+	if _, err := runGit("", "clone", "--quiet", "--bare", "--filter=blob:none", repoURI, cloneDir); err != nil {
+		return nil, errors.Wrap(err, "failed to clone repo")
+	}
+
+	revisionRange := toSHA
+	if fromSHA != "" {
+		if _, err := runGit(cloneDir, "merge-base", "--is-ancestor", fromSHA, toSHA); err == nil {
+			revisionRange = fmt.Sprintf("%s..%s", fromSHA, toSHA)
+		} else {
+			revisionRange = fmt.Sprintf("%s^!", toSHA)
+		}
+	}
+
+	out, err := runGit(cloneDir, "log", "--reverse", "--format=%H %s", revisionRange)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get log")
+	}
+
+	updates := []Update{}
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		update := Update{
+			Cursor: parts[0],
+		}
+		if len(parts) == 2 {
+			update.ReleaseNotes = parts[1]
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, nil
+}
+
+// gitReleaseMetadata returns the message and date of the annotated tag that ref
+// names. When ref is not an annotated tag, there are no release notes and the date of
+// the checked out commit is used.
+func gitReleaseMetadata(cloneDir string, ref string) (string, *time.Time, error) {
+	if ref != "" {
+		out, err := runGit(cloneDir, "for-each-ref", "--format=%(objecttype)%00%(taggerdate:iso-strict)%00%(contents)", "refs/tags/"+ref)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to get tag")
+		}
+
+		parts := strings.SplitN(out, "\x00", 3)
+		if len(parts) == 3 && parts[0] == "tag" {
+			releaseNotes := parts[2]
+			if i := strings.Index(releaseNotes, "-----BEGIN PGP SIGNATURE-----"); i != -1 {
+				releaseNotes = releaseNotes[:i]
+			}
+
+			var releasedAt *time.Time
+			if taggedAt, err := time.Parse(time.RFC3339, parts[1]); err == nil {
+				releasedAt = &taggedAt
+			}
+
+			return strings.TrimSpace(releaseNotes), releasedAt, nil
+		}
+	}
+
+	out, err := runGit(cloneDir, "log", "-1", "--format=%cI", "HEAD")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to get commit date")
+	}
+
+	committedAt, err := time.Parse(time.RFC3339, out)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to parse commit date")
+	}
+
+	return "", &committedAt, nil
+}
+
+func gitRepoName(repoURI string) string {
+	name := path.Base(strings.TrimSuffix(repoURI, "/"))
+	return strings.TrimSuffix(name, ".git")
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "git %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
 }
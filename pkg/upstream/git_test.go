@@ -0,0 +1,217 @@
+package upstream
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseGitURL(t *testing.T) {
+	tests := []struct {
+		name            string
+		uri             string
+		expectedRepoURI string
+		expectedSubPath string
+		expectedRef     string
+		expectedErr     bool
+	}{
+		{
+			name:            "git://github.com/org/repo",
+			uri:             "git://github.com/org/repo",
+			expectedRepoURI: "git://github.com/org/repo",
+			expectedSubPath: "",
+			expectedRef:     "",
+		},
+		{
+			name:            "git://github.com/org/repo//path/to/manifests?ref=v1.2.0",
+			uri:             "git://github.com/org/repo//path/to/manifests?ref=v1.2.0",
+			expectedRepoURI: "git://github.com/org/repo",
+			expectedSubPath: "path/to/manifests",
+			expectedRef:     "v1.2.0",
+		},
+		{
+			name:            "local bare repo",
+			uri:             "git:///tmp/repo.git//manifests?ref=main",
+			expectedRepoURI: "/tmp/repo.git",
+			expectedSubPath: "manifests",
+			expectedRef:     "main",
+		},
+		{
+			name:            "subpath cannot escape repo",
+			uri:             "git://github.com/org/repo//../../etc",
+			expectedRepoURI: "git://github.com/org/repo",
+			expectedSubPath: "etc",
+			expectedRef:     "",
+		},
+		{
+			name:        "ref that is an option",
+			uri:         "git://github.com/org/repo?ref=--orphan=x",
+			expectedErr: true,
+		},
+		{
+			name:        "no repo",
+			uri:         "git://github.com//manifests",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			u, err := url.ParseRequestURI(test.uri)
+			req.NoError(err)
+
+			repoURI, subPath, ref, err := parseGitURL(u)
+			if test.expectedErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			assert.Equal(t, test.expectedRepoURI, repoURI)
+			assert.Equal(t, test.expectedSubPath, subPath)
+			assert.Equal(t, test.expectedRef, ref)
+		})
+	}
+}
+
+func Test_downloadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	req := require.New(t)
+
+	workDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(workDir)
+
+	git := func(dir string, args ...string) string {
+		args = append([]string{"-c", "user.name=kots", "-c", "user.email=kots@example.com"}, args...)
+		out, err := runGit(dir, args...)
+		req.NoError(err)
+		return out
+	}
+
+	srcDir := filepath.Join(workDir, "src")
+	req.NoError(os.MkdirAll(filepath.Join(srcDir, "manifests"), 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(srcDir, "README.md"), []byte("readme"), 0644))
+	req.NoError(ioutil.WriteFile(filepath.Join(srcDir, "manifests", "deployment.yaml"), []byte("kind: Deployment"), 0644))
+
+	git(srcDir, "init", "--quiet")
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "--quiet", "-m", "first")
+	git(srcDir, "tag", "-a", "v1.0.0", "-m", "First release")
+	taggedSHA := git(srcDir, "rev-parse", "HEAD")
+
+	req.NoError(ioutil.WriteFile(filepath.Join(srcDir, "manifests", "service.yaml"), []byte("kind: Service"), 0644))
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "--quiet", "-m", "second")
+	headSHA := git(srcDir, "rev-parse", "HEAD")
+
+	bareDir := filepath.Join(workDir, "myapp.git")
+	git(workDir, "clone", "--quiet", "--bare", srcDir, bareDir)
+
+	u, err := url.ParseRequestURI("git://" + bareDir + "//manifests?ref=v1.0.0")
+	req.NoError(err)
+
+	upstream, err := downloadGit(u)
+	req.NoError(err)
+	assert.Equal(t, "myapp", upstream.Name)
+	assert.Equal(t, "plain", upstream.Type)
+	assert.Equal(t, taggedSHA, upstream.UpdateCursor)
+	assert.Equal(t, "v1.0.0", upstream.VersionLabel)
+	assert.Equal(t, "First release", upstream.ReleaseNotes)
+	assert.NotNil(t, upstream.ReleasedAt)
+	assert.ElementsMatch(t, []UpstreamFile{
+		{Path: "deployment.yaml", Content: []byte("kind: Deployment")},
+	}, upstream.Files)
+
+	u, err = url.ParseRequestURI("git://" + bareDir + "//manifests")
+	req.NoError(err)
+
+	upstream, err = downloadGit(u)
+	req.NoError(err)
+	assert.Equal(t, headSHA, upstream.UpdateCursor)
+	assert.Empty(t, upstream.ReleaseNotes)
+	assert.NotNil(t, upstream.ReleasedAt)
+	assert.Len(t, upstream.Files, 2)
+}
+
+func Test_gitListUpdates(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	req := require.New(t)
+
+	workDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(workDir)
+
+	git := func(dir string, args ...string) string {
+		args = append([]string{"-c", "user.name=kots", "-c", "user.email=kots@example.com"}, args...)
+		out, err := runGit(dir, args...)
+		req.NoError(err)
+		return out
+	}
+
+	srcDir := filepath.Join(workDir, "src")
+	req.NoError(os.MkdirAll(srcDir, 0755))
+	git(srcDir, "init", "--quiet")
+
+	commit := func(message string) string {
+		req.NoError(ioutil.WriteFile(filepath.Join(srcDir, "deployment.yaml"), []byte(message), 0644))
+		git(srcDir, "add", ".")
+		git(srcDir, "commit", "--quiet", "-m", message)
+		return git(srcDir, "rev-parse", "HEAD")
+	}
+
+	firstSHA := commit("first")
+	git(srcDir, "tag", "v1.0.0")
+	secondSHA := commit("second")
+	git(srcDir, "tag", "-a", "v1.1.0", "-m", "v1.1.0")
+	thirdSHA := commit("third")
+	git(srcDir, "tag", "v2.0.0-rc.1")
+	branch := git(srcDir, "rev-parse", "--abbrev-ref", "HEAD")
+
+	provider := gitProvider{}
+
+	u, err := url.ParseRequestURI("git://" + srcDir + "?ref=" + branch)
+	req.NoError(err)
+
+	updates, err := provider.ListUpdates(u, firstSHA, &FetchOptions{})
+	req.NoError(err)
+	assert.Equal(t, []Update{
+		{Cursor: secondSHA, VersionLabel: branch, ReleaseNotes: "second"},
+		{Cursor: thirdSHA, VersionLabel: branch, ReleaseNotes: "third"},
+	}, updates)
+
+	updates, err = provider.ListUpdates(u, thirdSHA, &FetchOptions{})
+	req.NoError(err)
+	assert.Empty(t, updates)
+
+	// pinned to a semver tag, newer tags are updates
+	u, err = url.ParseRequestURI("git://" + srcDir + "?ref=v1.0.0")
+	req.NoError(err)
+
+	updates, err = provider.ListUpdates(u, firstSHA, &FetchOptions{})
+	req.NoError(err)
+	assert.Equal(t, []Update{
+		{Cursor: secondSHA, VersionLabel: "v1.1.0"},
+	}, updates)
+
+	// pinned to a commit, there are no updates
+	u, err = url.ParseRequestURI("git://" + srcDir + "?ref=" + firstSHA)
+	req.NoError(err)
+
+	updates, err = provider.ListUpdates(u, firstSHA, &FetchOptions{})
+	req.NoError(err)
+	assert.Empty(t, updates)
+}
@@ -1,193 +1,350 @@
 package upstream
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/archive"
 	"github.com/replicatedhq/kots/pkg/util"
-	"k8s.io/helm/cmd/helm/search"
-	"k8s.io/helm/pkg/downloader"
-	"k8s.io/helm/pkg/getter"
-	"k8s.io/helm/pkg/helm/environment"
-	"k8s.io/helm/pkg/helm/helmpath"
-	"k8s.io/helm/pkg/repo"
 )
 
-func downloadHelm(u *url.URL, repoURI string) (*Upstream, error) {
+type helmProvider struct{}
+
+func (helmProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	return true, nil
+}
+
+func (helmProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	return downloadHelm(u, fetchOptions)
+}
+
+func (p helmProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	return checkForUpdatesByListing(p, u, currentCursor, fetchOptions)
+}
+
+func downloadHelm(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
 	repoName, chartName, chartVersion, err := parseHelmURL(u)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse helm uri")
 	}
 
-	if repoURI == "" {
-		repoURI = getKnownHelmRepoURI(repoName)
+	repoURI, fetchOptions, err := resolveHelmRepo(repoName, fetchOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	if repoURI == "" {
-		return nil, errors.New("unknown helm repo uri, try passing the repo uri")
+	g, err := newHelmHTTPGetter(repoURI, fetchOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create helm getter")
+	}
+
+	index, err := loadHelmRepoIndex(repoURI, g, fetchOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load repo index")
 	}
 
-	helmHome, err := ioutil.TempDir("", "kots")
+	availableVersions := []string{}
+	for _, chartVersion := range index.Entries[chartName] {
+		availableVersions = append(availableVersions, chartVersion.Version)
+	}
+
+	chartVersion, err = resolveChartVersion(availableVersions, chartVersion, fetchOptions.HelmIncludePrereleases)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve version of chart %s", chartName)
+	}
+
+	indexChartVersion, err := index.Get(chartName, chartVersion)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create temporary helm home")
+		return nil, errors.Wrap(err, "failed to find chart in repo index")
 	}
-	defer os.RemoveAll(helmHome)
-	if err := os.MkdirAll(filepath.Join(helmHome, "repository"), 0755); err != nil {
-		return nil, errors.Wrap(err, "failed to make directory for helm home")
+
+	archive, err := downloadHelmChartArchive(repoURI, indexChartVersion, g, fetchOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download chart")
 	}
-	reposFile := filepath.Join(helmHome, "repository", "repositories.yaml")
 
-	repoIndexFile, err := ioutil.TempFile("", "index")
+	files, err := readTarGzFromReader(bytes.NewReader(archive))
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create temporary index file")
+		return nil, errors.Wrap(err, "failed to read chart archive")
 	}
-	defer os.Remove(repoIndexFile.Name())
 
-	cacheIndexFile, err := ioutil.TempFile("", "cache")
+	files, err = vendorHelmDependencies(files, repoURI, fetchOptions)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create cache index file")
+		return nil, errors.Wrap(err, "failed to vendor chart dependencies")
+	}
+
+	upstream := &Upstream{
+		URI:          util.RemoveURLCredentials(u.String()),
+		Name:         chartName,
+		Type:         "helm",
+		Files:        files,
+		UpdateCursor: chartVersion,
+	}
+
+	return upstream, nil
+}
+
+// ListUpdates returns the chart versions in the repo that are newer than the current
+// version. When the uri has a version constraint, only versions that match it are
+// included.
+func (helmProvider) ListUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) ([]Update, error) {
+	repoName, chartName, versionSpec, err := parseHelmURL(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse helm uri")
 	}
-	defer os.Remove(cacheIndexFile.Name())
 
-	repoYAML := `apiVersion: v1
-generated: "2019-05-29T14:31:58.906598702Z"
-repositories: []`
-	if err := ioutil.WriteFile(reposFile, []byte(repoYAML), 0644); err != nil {
+	repoURI, fetchOptions, err := resolveHelmRepo(repoName, fetchOptions)
+	if err != nil {
 		return nil, err
 	}
 
-	c := repo.Entry{
-		Name:  repoName,
-		Cache: repoIndexFile.Name(),
-		URL:   repoURI,
+	g, err := newHelmHTTPGetter(repoURI, fetchOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create helm getter")
 	}
-	r, err := repo.NewChartRepository(&c, getter.All(environment.EnvSettings{}))
+
+	index, err := loadHelmRepoIndex(repoURI, g, fetchOptions)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create chart repository")
+		return nil, errors.Wrap(err, "failed to load repo index")
 	}
-	if err := r.DownloadIndexFile(cacheIndexFile.Name()); err != nil {
-		return nil, errors.Wrap(err, "failed to download index file")
+
+	availableVersions := []string{}
+	for _, chartVersion := range index.Entries[chartName] {
+		availableVersions = append(availableVersions, chartVersion.Version)
 	}
 
-	rf, err := repo.LoadRepositoriesFile(reposFile)
+	newerVersions, err := newerChartVersions(availableVersions, currentCursor, versionSpec, fetchOptions.HelmIncludePrereleases)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to load repositories file")
+		return nil, errors.Wrapf(err, "failed to find newer versions of chart %s", chartName)
 	}
-	rf.Update(&c)
 
-	i := search.NewIndex()
-	for _, re := range rf.Repositories {
-		n := re.Name
-		ind, err := repo.LoadIndexFile(repoIndexFile.Name())
+	updates := []Update{}
+	for _, newerVersion := range newerVersions {
+		updates = append(updates, Update{
+			Cursor:       newerVersion,
+			VersionLabel: newerVersion,
+		})
+	}
+
+	return updates, nil
+}
+
+// resolveHelmRepo returns the uri of the repo and the fetch options with the
+// credentials of the repo alias, when the repo uri wasn't passed explicitly
+func resolveHelmRepo(repoName string, fetchOptions *FetchOptions) (string, *FetchOptions, error) {
+	repoURI := fetchOptions.HelmRepoURI
+	if repoURI == "" {
+		helmRepo, err := getKnownHelmRepo(repoName, fetchOptions.HelmReposFile)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to load index file")
+			return "", nil, errors.Wrap(err, "failed to get known helm repo")
+		}
+		if helmRepo != nil {
+			repoURI = helmRepo.URL
+			fetchOptions = withHelmRepoAuth(fetchOptions, helmRepo)
 		}
+	}
 
-		i.AddRepo(n, ind, true)
+	if repoURI == "" {
+		return "", nil, errors.Errorf("unknown helm repo %q, add it with kots repo add or pass the repo uri", repoName)
 	}
 
-	if chartVersion == "" {
-		highestChartVersion := semver.MustParse("0.0.0")
-		for _, result := range i.All() {
-			if result.Chart.GetName() != chartName {
-				continue
-			}
+	return repoURI, fetchOptions, nil
+}
 
-			v, err := semver.NewVersion(result.Chart.GetVersion())
-			if err != nil {
-				return nil, errors.Wrap(err, "unable to parse chart version")
-			}
+// parseHelmURL returns the repo, chart name and version from a helm uri. The
+// version can be an exact version or a semver constraint (helm://stable/redis@~8.1).
+func parseHelmURL(u *url.URL) (string, string, string, error) {
+	repo := u.Host
+	chartName := strings.TrimLeft(u.Path, "/")
+	chartVersion := ""
+
+	chartAndVersion := strings.SplitN(chartName, "@", 2)
+	if len(chartAndVersion) > 1 {
+		chartName = chartAndVersion[0]
+		chartVersion = strings.Trim(strings.TrimSpace(chartAndVersion[1]), `"'`)
+	}
+
+	return repo, chartName, chartVersion, nil
+}
 
-			if v.GreaterThan(highestChartVersion) {
-				highestChartVersion = v
+var constraintSeparatorRegex = regexp.MustCompile(`([0-9A-Za-z*])\s+([<>=!~^])`)
+
+// constraintVersionRegex matches the versions in a constraint, with the prerelease
+// and build metadata captured separately
+var constraintVersionRegex = regexp.MustCompile(`(v?[0-9xX*]+(?:\.[0-9xX*]+){0,2})(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?`)
+
+// resolveChartVersion picks the version of the chart to download. An empty version
+// spec resolves to the highest version, an exact version must be available, and
+// anything else is treated as a semver constraint. Prereleases are only considered
+// when includePrereleases is set or when the spec asks for a prerelease.
+func resolveChartVersion(availableVersions []string, versionSpec string, includePrereleases bool) (string, error) {
+	if versionSpec != "" {
+		for _, availableVersion := range availableVersions {
+			if availableVersion == versionSpec {
+				return availableVersion, nil
 			}
 		}
 
-		chartVersion = highestChartVersion.String()
+		if _, err := semver.NewVersion(versionSpec); err == nil {
+			return "", errors.Errorf("version %s not found", versionSpec)
+		}
 	}
 
-	for _, result := range i.All() {
-		if result.Chart.GetName() != chartName {
-			continue
+	var constraint *chartVersionConstraint
+	if versionSpec != "" {
+		c, err := parseChartVersionConstraint(versionSpec)
+		if err != nil {
+			return "", err
+		}
+		constraint = c
+	}
+
+	var highestVersion *semver.Version
+	highestVersionString := ""
+	for _, availableVersion := range availableVersions {
+		v, err := semver.NewVersion(availableVersion)
+		if err != nil {
+			return "", errors.Wrap(err, "unable to parse chart version")
 		}
 
-		if result.Chart.GetVersion() != chartVersion {
+		matches, err := chartVersionMatches(v, constraint, includePrereleases)
+		if err != nil {
+			return "", err
+		}
+		if !matches {
 			continue
 		}
 
-		dl := downloader.ChartDownloader{
-			HelmHome: helmpath.Home(helmHome),
-			Out:      os.Stdout,
-			Getters:  getter.All(environment.EnvSettings{}),
+		if highestVersion == nil || v.GreaterThan(highestVersion) {
+			highestVersion = v
+			highestVersionString = availableVersion
 		}
+	}
 
-		archiveDir, err := ioutil.TempDir("", "archive")
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to create archive directory for chart")
+	if highestVersion == nil {
+		if versionSpec == "" {
+			return "", errors.New("no versions found")
 		}
-		defer os.RemoveAll(archiveDir)
+		return "", errors.Errorf("no versions found matching %q", versionSpec)
+	}
+
+	return highestVersionString, nil
+}
 
-		chartRef, err := repo.FindChartInRepoURL(repoURI, result.Chart.GetName(), chartVersion, "", "", "", getter.All(environment.EnvSettings{}))
+// newerChartVersions returns the available versions that are newer than the current
+// version, oldest first. An exact version spec is a pin, and doesn't limit which
+// versions are newer, but a constraint does.
+func newerChartVersions(availableVersions []string, currentVersion string, versionSpec string, includePrereleases bool) ([]string, error) {
+	var current *semver.Version
+	if currentVersion != "" {
+		v, err := semver.NewVersion(currentVersion)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to find chart in repo url")
+			return nil, errors.Wrapf(err, "unable to parse current version %q", currentVersion)
 		}
+		current = v
+	}
 
-		_, _, err = dl.DownloadTo(chartRef, result.Chart.GetVersion(), archiveDir)
+	var constraint *chartVersionConstraint
+	if _, err := semver.NewVersion(versionSpec); versionSpec != "" && err != nil {
+		c, err := parseChartVersionConstraint(versionSpec)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to download chart")
+			return nil, err
 		}
+		constraint = c
+	}
 
-		files, err := readTarGz(path.Join(archiveDir, fmt.Sprintf("%s-%s.tgz", chartName, chartVersion)))
+	newerVersions := []*semver.Version{}
+	for _, availableVersion := range availableVersions {
+		v, err := semver.NewVersion(availableVersion)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to read chart archive")
+			return nil, errors.Wrap(err, "unable to parse chart version")
 		}
 
-		upstream := &Upstream{
-			URI:          u.RequestURI(),
-			Name:         chartName,
-			Type:         "helm",
-			Files:        files,
-			UpdateCursor: chartVersion,
+		if current != nil && !v.GreaterThan(current) {
+			continue
 		}
 
-		return upstream, nil
+		matches, err := chartVersionMatches(v, constraint, includePrereleases)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			newerVersions = append(newerVersions, v)
+		}
 	}
 
-	return nil, errors.New("chart version not found")
+	sort.Sort(semver.Collection(newerVersions))
+
+	versions := []string{}
+	for _, v := range newerVersions {
+		versions = append(versions, v.Original())
+	}
+
+	return versions, nil
 }
 
-func parseHelmURL(u *url.URL) (string, string, string, error) {
-	repo := u.Host
-	chartName := strings.TrimLeft(u.Path, "/")
-	chartVersion := ""
+// chartVersionConstraint is a parsed version constraint, along with the spec that it
+// was parsed from so that it can be rewritten to check prereleases
+type chartVersionConstraint struct {
+	spec       string
+	constraint *semver.Constraints
+}
 
-	chartAndVersion := strings.Split(chartName, "@")
-	if len(chartAndVersion) > 1 {
-		chartName = chartAndVersion[0]
-		chartVersion = chartAndVersion[1]
+func parseChartVersionConstraint(versionSpec string) (*chartVersionConstraint, error) {
+	// helm style constraints separate with spaces, but semver v1 expects commas
+	spec := constraintSeparatorRegex.ReplaceAllString(versionSpec, "$1, $2")
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse version constraint %q", versionSpec)
 	}
 
-	return repo, chartName, chartVersion, nil
+	return &chartVersionConstraint{
+		spec:       spec,
+		constraint: constraint,
+	}, nil
 }
 
-func getKnownHelmRepoURI(repoName string) string {
-	val, ok := KnownRepos[repoName]
-	if !ok {
-		return ""
+// chartVersionMatches returns true if the version can be picked with the constraint.
+// Prereleases are only considered when includePrereleases is set or when the
+// constraint asks for a prerelease.
+func chartVersionMatches(v *semver.Version, constraint *chartVersionConstraint, includePrereleases bool) (bool, error) {
+	if v.Prerelease() != "" && !includePrereleases && constraint == nil {
+		return false, nil
 	}
 
-	return val
+	if constraint == nil {
+		return true, nil
+	}
+
+	if v.Prerelease() == "" || !includePrereleases {
+		return constraint.constraint.Check(v), nil
+	}
+
+	// constraints never match prereleases unless they contain one. Giving every
+	// version in the constraint a prerelease that sorts just above this one
+	// compares them with the prerelease the same way as the releases, so 2.0.0-rc1
+	// matches <2.0.0 but not >=2.0.0.
+	prereleaseSpec := constraintVersionRegex.ReplaceAllStringFunc(constraint.spec, func(version string) string {
+		m := constraintVersionRegex.FindStringSubmatch(version)
+		if m[2] != "" {
+			return version
+		}
+		return m[1] + "-" + v.Prerelease() + ".0" + m[3]
+	})
+	prereleaseConstraint, err := semver.NewConstraint(prereleaseSpec)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse version constraint %q", prereleaseSpec)
+	}
+
+	return prereleaseConstraint.Check(v), nil
 }
 
 func readTarGz(source string) ([]UpstreamFile, error) {
@@ -197,71 +354,69 @@ func readTarGz(source string) ([]UpstreamFile, error) {
 	}
 	defer f.Close()
 
-	gzf, err := gzip.NewReader(f)
+	return readTarGzFromReader(f)
+}
+
+func readTarGzFromReader(r io.Reader) ([]UpstreamFile, error) {
+	files, err := archive.ReadTarGz(r, archive.Options{})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create gzip reader")
+		return nil, errors.Wrap(err, "failed to read tar archive")
 	}
 
-	tarReader := tar.NewReader(gzf)
+	return upstreamFilesFromArchive(files), nil
+}
 
-	upstreamFiles := []UpstreamFile{}
-	for {
-		header, err := tarReader.Next()
+func readTarFromReader(r io.Reader) ([]UpstreamFile, error) {
+	files, err := archive.ReadTar(r, archive.Options{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tar archive")
+	}
 
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to advance in tar archive")
-		}
+	return upstreamFilesFromArchive(files), nil
+}
 
-		name := header.Name
+// upstreamFilesFromArchive returns the files read from an archive without any
+// leading directories that they all share
+func upstreamFilesFromArchive(files []archive.File) []UpstreamFile {
+	upstreamFiles := []UpstreamFile{}
+	for _, file := range files {
+		upstreamFiles = append(upstreamFiles, UpstreamFile{
+			Path:    file.Path,
+			Content: file.Content,
+		})
+	}
 
-		switch header.Typeflag {
-		case tar.TypeReg:
-			buf := new(bytes.Buffer)
-			_, err = buf.ReadFrom(tarReader)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to read file from tar archive")
-			}
-			upstreamFile := UpstreamFile{
-				Path:    name,
-				Content: buf.Bytes(),
-			}
+	return removeCommonPrefix(upstreamFiles)
+}
 
-			upstreamFiles = append(upstreamFiles, upstreamFile)
-		default:
-			continue
-		}
+// removeCommonPrefix removes any leading directories that are shared by all files
+func removeCommonPrefix(upstreamFiles []UpstreamFile) []UpstreamFile {
+	if len(upstreamFiles) == 0 {
+		return upstreamFiles
 	}
 
-	// remove any common prefix from all files
-	if len(upstreamFiles) > 0 {
-		firstFileDir, _ := path.Split(upstreamFiles[0].Path)
-		commonPrefix := strings.Split(firstFileDir, string(os.PathSeparator))
+	firstFileDir, _ := path.Split(upstreamFiles[0].Path)
+	commonPrefix := strings.Split(firstFileDir, string(os.PathSeparator))
 
-		for _, file := range upstreamFiles {
-			d, _ := path.Split(file.Path)
-			dirs := strings.Split(d, string(os.PathSeparator))
+	for _, file := range upstreamFiles {
+		d, _ := path.Split(file.Path)
+		dirs := strings.Split(d, string(os.PathSeparator))
 
-			commonPrefix = util.CommonSlicePrefix(commonPrefix, dirs)
+		commonPrefix = util.CommonSlicePrefix(commonPrefix, dirs)
 
-		}
-
-		cleanedUpstreamFiles := []UpstreamFile{}
-		for _, file := range upstreamFiles {
-			d, f := path.Split(file.Path)
-			d2 := strings.Split(d, string(os.PathSeparator))
+	}
 
-			cleanedUpstreamFile := file
-			d2 = d2[len(commonPrefix):]
-			cleanedUpstreamFile.Path = path.Join(path.Join(d2...), f)
+	cleanedUpstreamFiles := []UpstreamFile{}
+	for _, file := range upstreamFiles {
+		d, f := path.Split(file.Path)
+		d2 := strings.Split(d, string(os.PathSeparator))
 
-			cleanedUpstreamFiles = append(cleanedUpstreamFiles, cleanedUpstreamFile)
-		}
+		cleanedUpstreamFile := file
+		d2 = d2[len(commonPrefix):]
+		cleanedUpstreamFile.Path = path.Join(path.Join(d2...), f)
 
-		upstreamFiles = cleanedUpstreamFiles
+		cleanedUpstreamFiles = append(cleanedUpstreamFiles, cleanedUpstreamFile)
 	}
 
-	return upstreamFiles, nil
+	return cleanedUpstreamFiles
 }
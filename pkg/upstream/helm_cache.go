@@ -0,0 +1,259 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/helm/pkg/repo"
+)
+
+// helmCacheMetadata is stored next to a cached index or chart archive and holds the
+// validators used to revalidate it
+type helmCacheMetadata struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// DefaultCacheDir returns the directory that kots caches downloads in when no cache
+// dir is configured
+func DefaultCacheDir() string {
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cacheDir, "kots")
+	}
+
+	return filepath.Join(os.TempDir(), "kots-cache")
+}
+
+// helmRepoCacheDir returns the directory that the index and charts of a repo are
+// cached in
+func helmRepoCacheDir(repoURI string, fetchOptions *FetchOptions) string {
+	cacheDir := fetchOptions.CacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir()
+	}
+
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(strings.TrimSuffix(repoURI, "/"))))
+	return filepath.Join(cacheDir, "helm", "repositories", key[:16])
+}
+
+// loadHelmRepoIndex returns the index of the helm repo. A cached index is revalidated
+// with the repo, and is used as is when working offline.
+func loadHelmRepoIndex(repoURI string, g *helmHTTPGetter, fetchOptions *FetchOptions) (*repo.IndexFile, error) {
+	cacheDir := helmRepoCacheDir(repoURI, fetchOptions)
+	indexPath := filepath.Join(cacheDir, "index.yaml")
+	metadataPath := filepath.Join(cacheDir, "index-metadata.json")
+
+	isCached := true
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		isCached = false
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to check for cached index")
+	}
+
+	if fetchOptions.Offline {
+		if !isCached {
+			return nil, errors.Errorf("the index for helm repo %s is not cached, it must be downloaded once before working offline", repoURI)
+		}
+		return repo.LoadIndexFile(indexPath)
+	}
+
+	header := http.Header{}
+	if isCached {
+		h, err := helmCacheRevalidationHeader(metadataPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cached index metadata")
+		}
+		header = h
+	}
+
+	indexURL := strings.TrimSuffix(repoURI, "/") + "/index.yaml"
+	resp, err := g.do(indexURL, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download index")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		return repo.LoadIndexFile(indexPath)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch %s: %s", indexURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read index")
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create cache dir")
+	}
+
+	// load from a temp file so that an invalid index never replaces a good one
+	tmpIndexPath := indexPath + ".tmp"
+	if err := ioutil.WriteFile(tmpIndexPath, body, 0644); err != nil {
+		return nil, errors.Wrap(err, "failed to write index")
+	}
+	defer os.Remove(tmpIndexPath)
+
+	index, err := repo.LoadIndexFile(tmpIndexPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load index file")
+	}
+
+	if err := os.Rename(tmpIndexPath, indexPath); err != nil {
+		return nil, errors.Wrap(err, "failed to cache index")
+	}
+
+	if err := writeHelmCacheMetadata(metadataPath, indexURL, resp); err != nil {
+		return nil, errors.Wrap(err, "failed to write index metadata")
+	}
+
+	return index, nil
+}
+
+// downloadHelmChartArchive returns the chart archive for a version from the index,
+// using the cached archive when it matches the digest in the index. When the index
+// has no digest, the cached archive is revalidated with the repo instead.
+func downloadHelmChartArchive(repoURI string, chartVersion *repo.ChartVersion, g *helmHTTPGetter, fetchOptions *FetchOptions) ([]byte, error) {
+	cacheDir := helmRepoCacheDir(repoURI, fetchOptions)
+	archivePath := filepath.Join(cacheDir, fmt.Sprintf("%s-%s.tgz", chartVersion.Name, chartVersion.Version))
+	metadataPath := archivePath + ".json"
+
+	cachedContent, err := ioutil.ReadFile(archivePath)
+	isCached := err == nil
+	if isCached && chartVersion.Digest != "" {
+		if verifyHelmChartDigest(cachedContent, chartVersion.Digest) == nil {
+			return cachedContent, nil
+		}
+		isCached = false
+	}
+
+	if fetchOptions.Offline {
+		if !isCached {
+			return nil, errors.Errorf("chart %s %s is not cached, it must be downloaded once before working offline", chartVersion.Name, chartVersion.Version)
+		}
+		return cachedContent, nil
+	}
+
+	if len(chartVersion.URLs) == 0 {
+		return nil, errors.Errorf("chart %s %s has no download urls", chartVersion.Name, chartVersion.Version)
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(repoURI, chartVersion.URLs[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve chart url")
+	}
+
+	header := http.Header{}
+	if isCached {
+		h, err := helmCacheRevalidationHeader(metadataPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cached chart metadata")
+		}
+		header = h
+	}
+
+	resp, err := g.do(chartURL, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download chart")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		return cachedContent, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch %s: %s", chartURL, resp.Status)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read chart")
+	}
+
+	if err := verifyHelmChartDigest(content, chartVersion.Digest); err != nil {
+		return nil, errors.Wrapf(err, "failed to verify chart %s %s", chartVersion.Name, chartVersion.Version)
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create cache dir")
+	}
+	if err := ioutil.WriteFile(archivePath, content, 0644); err != nil {
+		return nil, errors.Wrap(err, "failed to cache chart")
+	}
+	if err := writeHelmCacheMetadata(metadataPath, chartURL, resp); err != nil {
+		return nil, errors.Wrap(err, "failed to write chart metadata")
+	}
+
+	return content, nil
+}
+
+// helmCacheRevalidationHeader returns the conditional request headers for the
+// validators stored at metadataPath. There are none if no metadata was stored.
+func helmCacheRevalidationHeader(metadataPath string) (http.Header, error) {
+	header := http.Header{}
+
+	content, err := ioutil.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		return header, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata")
+	}
+
+	metadata := helmCacheMetadata{}
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal metadata")
+	}
+
+	if metadata.ETag != "" {
+		header.Set("If-None-Match", metadata.ETag)
+	}
+	if metadata.LastModified != "" {
+		header.Set("If-Modified-Since", metadata.LastModified)
+	}
+
+	return header, nil
+}
+
+// writeHelmCacheMetadata stores the validators from the response at metadataPath
+func writeHelmCacheMetadata(metadataPath string, url string, resp *http.Response) error {
+	metadata, err := json.Marshal(helmCacheMetadata{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal metadata")
+	}
+
+	if err := ioutil.WriteFile(metadataPath, metadata, 0644); err != nil {
+		return errors.Wrap(err, "failed to write metadata")
+	}
+
+	return nil
+}
+
+// verifyHelmChartDigest checks the archive against the sha256 digest in the index.
+// Indexes are not required to include digests.
+func verifyHelmChartDigest(content []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+
+	actualDigest := fmt.Sprintf("%x", sha256.Sum256(content))
+	if actualDigest != strings.TrimPrefix(digest, "sha256:") {
+		return errors.Errorf("digest mismatch, expected %s, got %s", digest, actualDigest)
+	}
+
+	return nil
+}
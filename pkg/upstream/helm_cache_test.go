@@ -0,0 +1,217 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	hapichart "k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+)
+
+func Test_helmRepoCache(t *testing.T) {
+	req := require.New(t)
+
+	chart := mustCreateTarGz(t, map[string]string{"mychart/Chart.yaml": "name: mychart\nversion: 0.1.0"})
+	index := fmt.Sprintf(`apiVersion: v1
+entries:
+  mychart:
+  - name: mychart
+    version: 0.1.0
+    digest: %x
+    urls:
+    - mychart-0.1.0.tgz
+`, sha256.Sum256(chart))
+
+	indexRequests := 0
+	notModifiedResponses := 0
+	chartRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			indexRequests++
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModifiedResponses++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, index)
+		case "/mychart-0.1.0.tgz":
+			chartRequests++
+			w.Write(chart)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(cacheDir)
+
+	fetchOptions := &FetchOptions{CacheDir: cacheDir}
+	g, err := newHelmHTTPGetter(server.URL, fetchOptions)
+	req.NoError(err)
+
+	// working offline before anything is cached fails
+	_, err = loadHelmRepoIndex(server.URL, g, &FetchOptions{CacheDir: cacheDir, Offline: true})
+	req.Error(err)
+	assert.Contains(t, err.Error(), "is not cached")
+	assert.Equal(t, 0, indexRequests)
+
+	repoIndex, err := loadHelmRepoIndex(server.URL, g, fetchOptions)
+	req.NoError(err)
+	req.True(repoIndex.Has("mychart", "0.1.0"))
+	assert.Equal(t, 1, indexRequests)
+	assert.Equal(t, 0, notModifiedResponses)
+
+	// the cached index is revalidated with its etag
+	repoIndex, err = loadHelmRepoIndex(server.URL, g, fetchOptions)
+	req.NoError(err)
+	req.True(repoIndex.Has("mychart", "0.1.0"))
+	assert.Equal(t, 2, indexRequests)
+	assert.Equal(t, 1, notModifiedResponses)
+
+	chartVersion, err := repoIndex.Get("mychart", "0.1.0")
+	req.NoError(err)
+
+	content, err := downloadHelmChartArchive(server.URL, chartVersion, g, fetchOptions)
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Equal(t, 1, chartRequests)
+
+	content, err = downloadHelmChartArchive(server.URL, chartVersion, g, fetchOptions)
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Equal(t, 1, chartRequests)
+
+	// once cached, the index and the chart are available offline
+	offlineFetchOptions := &FetchOptions{CacheDir: cacheDir, Offline: true}
+	repoIndex, err = loadHelmRepoIndex(server.URL, g, offlineFetchOptions)
+	req.NoError(err)
+	assert.Equal(t, 2, indexRequests)
+
+	_, err = downloadHelmChartArchive(server.URL, chartVersion, g, offlineFetchOptions)
+	req.NoError(err)
+
+	chartVersion.Digest = "0000"
+	_, err = downloadHelmChartArchive(server.URL, chartVersion, g, fetchOptions)
+	req.Error(err)
+}
+
+func Test_helmChartArchiveWithoutDigest(t *testing.T) {
+	req := require.New(t)
+
+	chart := mustCreateTarGz(t, map[string]string{"mychart/Chart.yaml": "name: mychart\nversion: 0.1.0"})
+	etag := `"v1"`
+
+	chartRequests := 0
+	notModifiedResponses := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chartRequests++
+		if r.Header.Get("If-None-Match") == etag {
+			notModifiedResponses++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(chart)
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(cacheDir)
+
+	fetchOptions := &FetchOptions{CacheDir: cacheDir}
+	g, err := newHelmHTTPGetter(server.URL, fetchOptions)
+	req.NoError(err)
+
+	chartVersion := &repo.ChartVersion{
+		Metadata: &hapichart.Metadata{Name: "mychart", Version: "0.1.0"},
+		URLs:     []string{"mychart-0.1.0.tgz"},
+	}
+
+	content, err := downloadHelmChartArchive(server.URL, chartVersion, g, fetchOptions)
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Equal(t, 1, chartRequests)
+
+	// there's no digest to check the cached archive against, so it's revalidated
+	content, err = downloadHelmChartArchive(server.URL, chartVersion, g, fetchOptions)
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Equal(t, 2, chartRequests)
+	assert.Equal(t, 1, notModifiedResponses)
+
+	// a chart that was republished with the same version replaces the cached archive
+	chart = mustCreateTarGz(t, map[string]string{"mychart/Chart.yaml": "name: mychart\nversion: 0.1.0\ndescription: republished"})
+	etag = `"v2"`
+
+	content, err = downloadHelmChartArchive(server.URL, chartVersion, g, fetchOptions)
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Equal(t, 3, chartRequests)
+	assert.Equal(t, 1, notModifiedResponses)
+
+	// the cached archive is used as is when working offline
+	content, err = downloadHelmChartArchive(server.URL, chartVersion, g, &FetchOptions{CacheDir: cacheDir, Offline: true})
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Equal(t, 3, chartRequests)
+}
+
+func Test_helmChartDownloadCredentials(t *testing.T) {
+	req := require.New(t)
+
+	chart := mustCreateTarGz(t, map[string]string{"mychart/Chart.yaml": "name: mychart\nversion: 0.1.0"})
+
+	chartAuthorization := "unset"
+	chartServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chartAuthorization = r.Header.Get("Authorization")
+		w.Write(chart)
+	}))
+	defer chartServer.Close()
+
+	indexAuthorization := ""
+	repoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		indexAuthorization = r.Header.Get("Authorization")
+		fmt.Fprintf(w, `apiVersion: v1
+entries:
+  mychart:
+  - name: mychart
+    version: 0.1.0
+    digest: %x
+    urls:
+    - %s/mychart-0.1.0.tgz
+`, sha256.Sum256(chart), chartServer.URL)
+	}))
+	defer repoServer.Close()
+
+	cacheDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(cacheDir)
+
+	fetchOptions := &FetchOptions{CacheDir: cacheDir, HelmRepoUsername: "user", HelmRepoPassword: "pass"}
+	g, err := newHelmHTTPGetter(repoServer.URL, fetchOptions)
+	req.NoError(err)
+
+	repoIndex, err := loadHelmRepoIndex(repoServer.URL, g, fetchOptions)
+	req.NoError(err)
+	assert.NotEmpty(t, indexAuthorization)
+
+	chartVersion, err := repoIndex.Get("mychart", "0.1.0")
+	req.NoError(err)
+
+	content, err := downloadHelmChartArchive(repoServer.URL, chartVersion, g, fetchOptions)
+	req.NoError(err)
+	assert.Equal(t, chart, content)
+	assert.Empty(t, chartAuthorization)
+}
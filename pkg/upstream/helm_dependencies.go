@@ -0,0 +1,292 @@
+package upstream
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/repo"
+	"k8s.io/helm/pkg/resolver"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	helmRequirementsFile = "requirements.yaml"
+	helmLockFile         = "requirements.lock"
+)
+
+// vendorHelmDependencies downloads the dependencies declared in the chart's
+// requirements.yaml that are not already in the charts/ directory, and returns the
+// chart files with the dependency archives and a requirements.lock added. When the
+// chart has a lock that matches its requirements, the locked versions are used.
+// Dependencies with an alias are resolved separately, so that each alias of a chart
+// can use a different version of it.
+func vendorHelmDependencies(files []UpstreamFile, repoURI string, fetchOptions *FetchOptions) ([]UpstreamFile, error) {
+	var requirementsContent, lockContent []byte
+	for _, file := range files {
+		switch file.Path {
+		case helmRequirementsFile:
+			requirementsContent = file.Content
+		case helmLockFile:
+			lockContent = file.Content
+		}
+	}
+
+	if requirementsContent == nil {
+		return files, nil
+	}
+
+	requirements := chartutil.Requirements{}
+	if err := yaml.Unmarshal(requirementsContent, &requirements); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal requirements")
+	}
+	if len(requirements.Dependencies) == 0 {
+		return files, nil
+	}
+
+	digest, err := resolver.HashReq(&requirements)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash requirements")
+	}
+
+	lockedVersions := map[string]string{}
+	if lockContent != nil {
+		lock := chartutil.RequirementsLock{}
+		if err := yaml.Unmarshal(lockContent, &lock); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal requirements lock")
+		}
+
+		// a lock that doesn't match the requirements is out of date and is re-resolved.
+		// helm doesn't record aliases in the lock, so locked dependencies are matched
+		// to the requirements in order.
+		if lock.Digest == digest {
+			used := make([]bool, len(lock.Dependencies))
+			for _, dependency := range requirements.Dependencies {
+				for i, locked := range lock.Dependencies {
+					if used[i] || locked.Name != dependency.Name {
+						continue
+					}
+					if locked.Alias != "" && locked.Alias != dependency.Alias {
+						continue
+					}
+					used[i] = true
+					lockedVersions[helmDependencyKey(dependency)] = locked.Version
+					break
+				}
+			}
+		}
+	}
+
+	lock := chartutil.RequirementsLock{
+		Generated:    time.Now().UTC(),
+		Digest:       digest,
+		Dependencies: []*chartutil.Dependency{},
+	}
+
+	indexes := map[string]*repo.IndexFile{}
+	getters := map[string]*helmHTTPGetter{}
+	for _, dependency := range requirements.Dependencies {
+		if version, ok := vendoredHelmDependencyVersion(files, dependency); ok {
+			lock.Dependencies = append(lock.Dependencies, &chartutil.Dependency{
+				Name:       dependency.Name,
+				Version:    version,
+				Repository: dependency.Repository,
+				Alias:      dependency.Alias,
+			})
+			continue
+		}
+
+		if strings.HasPrefix(dependency.Repository, "file://") {
+			return nil, errors.Errorf("dependency %s is in a local directory and is not vendored in the chart", dependency.Name)
+		}
+
+		dependencyRepo, err := resolveHelmDependencyRepo(dependency.Repository, fetchOptions.HelmReposFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve repository for dependency %s", dependency.Name)
+		}
+		dependencyRepoURI := dependencyRepo.URL
+
+		g, ok := getters[dependencyRepoURI]
+		if !ok {
+			g, err = getHelmDependencyGetter(dependencyRepo, repoURI, fetchOptions)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create helm getter")
+			}
+			getters[dependencyRepoURI] = g
+		}
+
+		index, ok := indexes[dependencyRepoURI]
+		if !ok {
+			index, err = loadHelmRepoIndex(dependencyRepoURI, g, fetchOptions)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load index for dependency %s", dependency.Name)
+			}
+			indexes[dependencyRepoURI] = index
+		}
+
+		versionSpec := dependency.Version
+		if lockedVersion, ok := lockedVersions[helmDependencyKey(dependency)]; ok {
+			versionSpec = lockedVersion
+		}
+
+		availableVersions := []string{}
+		for _, chartVersion := range index.Entries[dependency.Name] {
+			availableVersions = append(availableVersions, chartVersion.Version)
+		}
+
+		version, err := resolveChartVersion(availableVersions, versionSpec, fetchOptions.HelmIncludePrereleases)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve version of dependency %s", dependency.Name)
+		}
+
+		chartVersion, err := index.Get(dependency.Name, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find dependency %s", dependency.Name)
+		}
+
+		archive, err := downloadHelmChartArchive(dependencyRepoURI, chartVersion, g, fetchOptions)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to download dependency %s", dependency.Name)
+		}
+
+		files = append(files, UpstreamFile{
+			Path:    path.Join("charts", fmt.Sprintf("%s-%s.tgz", dependency.Name, version)),
+			Content: archive,
+		})
+
+		lock.Dependencies = append(lock.Dependencies, &chartutil.Dependency{
+			Name:       dependency.Name,
+			Version:    version,
+			Repository: dependency.Repository,
+			Alias:      dependency.Alias,
+		})
+	}
+
+	lockContent, err = yaml.Marshal(lock)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal requirements lock")
+	}
+
+	filesWithLock := []UpstreamFile{}
+	for _, file := range files {
+		if file.Path != helmLockFile {
+			filesWithLock = append(filesWithLock, file)
+		}
+	}
+	filesWithLock = append(filesWithLock, UpstreamFile{
+		Path:    helmLockFile,
+		Content: lockContent,
+	})
+
+	return filesWithLock, nil
+}
+
+// helmDependencyKey is the name that a dependency is rendered as, which is unique
+// in the requirements even when a chart is a dependency more than once
+func helmDependencyKey(dependency *chartutil.Dependency) string {
+	if dependency.Alias != "" {
+		return dependency.Alias
+	}
+	return dependency.Name
+}
+
+// vendoredHelmDependencyVersion returns the version of a dependency that is already
+// in the charts/ directory, either as an archive or as an unpacked chart. Like helm,
+// a vendored chart is only used for the dependency when it matches the version
+// constraint, so aliases of a chart with different versions are all vendored.
+func vendoredHelmDependencyVersion(files []UpstreamFile, dependency *chartutil.Dependency) (string, bool) {
+	name := dependency.Name
+	for _, file := range files {
+		if file.Path == path.Join("charts", name, "Chart.yaml") {
+			metadata, err := chartutil.UnmarshalChartfile(file.Content)
+			if err != nil {
+				continue
+			}
+			if helmDependencyVersionMatches(dependency, metadata.Version) {
+				return metadata.Version, true
+			}
+			continue
+		}
+
+		dir, filename := path.Split(file.Path)
+		if dir != "charts/" || !isTarGzFilename(filename) {
+			continue
+		}
+		nameAndVersion := trimArchiveExtension(filename)
+		if !strings.HasPrefix(nameAndVersion, name+"-") {
+			continue
+		}
+		// the remainder has to be a version, not the rest of a longer chart name
+		version := strings.TrimPrefix(nameAndVersion, name+"-")
+		if _, err := semver.NewVersion(version); err == nil && helmDependencyVersionMatches(dependency, version) {
+			return version, true
+		}
+	}
+
+	return "", false
+}
+
+func helmDependencyVersionMatches(dependency *chartutil.Dependency, version string) bool {
+	if dependency.Version == "" || dependency.Version == version {
+		return true
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	constraint, err := parseChartVersionConstraint(dependency.Version)
+	if err != nil {
+		// a version that can't be checked is left to helm to report
+		return true
+	}
+
+	matches, err := chartVersionMatches(v, constraint, true)
+	return err == nil && matches
+}
+
+// resolveHelmDependencyRepo returns the dependency repository, which can be a url
+// or a repository name (@stable or alias:stable)
+func resolveHelmDependencyRepo(repository string, reposFile string) (*HelmRepo, error) {
+	repoName := ""
+	if strings.HasPrefix(repository, "@") {
+		repoName = strings.TrimPrefix(repository, "@")
+	} else if strings.HasPrefix(repository, "alias:") {
+		repoName = strings.TrimPrefix(repository, "alias:")
+	}
+
+	if repoName == "" {
+		if repository == "" {
+			return nil, errors.New("no repository")
+		}
+		return &HelmRepo{URL: strings.TrimSuffix(repository, "/")}, nil
+	}
+
+	helmRepo, err := getKnownHelmRepo(repoName, reposFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get known helm repo")
+	}
+	if helmRepo == nil {
+		return nil, errors.Errorf("unknown helm repo %q", repoName)
+	}
+
+	return helmRepo, nil
+}
+
+// getHelmDependencyGetter only sends the credentials from the fetch options to the
+// repo that the chart was pulled from, other repos use their own credentials
+func getHelmDependencyGetter(dependencyRepo *HelmRepo, repoURI string, fetchOptions *FetchOptions) (*helmHTTPGetter, error) {
+	if strings.TrimSuffix(dependencyRepo.URL, "/") == strings.TrimSuffix(repoURI, "/") {
+		return newHelmHTTPGetter(repoURI, fetchOptions)
+	}
+
+	return newHelmHTTPGetter(dependencyRepo.URL, withHelmRepoAuth(&FetchOptions{
+		HelmRepoCAFile:             fetchOptions.HelmRepoCAFile,
+		HelmRepoInsecureSkipVerify: fetchOptions.HelmRepoInsecureSkipVerify,
+		HTTPClientOptions:          fetchOptions.HTTPClientOptions,
+	}, dependencyRepo))
+}
@@ -0,0 +1,269 @@
+package upstream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/resolver"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_vendorHelmDependencies(t *testing.T) {
+	redis100 := mustCreateTarGz(t, map[string]string{"redis/Chart.yaml": "name: redis\nversion: 1.0.0"})
+	redis110 := mustCreateTarGz(t, map[string]string{"redis/Chart.yaml": "name: redis\nversion: 1.1.0"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprint(w, `apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 1.1.0
+    urls:
+    - redis-1.1.0.tgz
+  - name: redis
+    version: 1.0.0
+    urls:
+    - redis-1.0.0.tgz
+`)
+		case "/redis-1.0.0.tgz":
+			w.Write(redis100)
+		case "/redis-1.1.0.tgz":
+			w.Write(redis110)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	requirements := fmt.Sprintf(`dependencies:
+- name: redis
+  version: ~1.0
+  repository: %s
+  alias: cache
+- name: postgres
+  version: 2.0.0
+  repository: file://../postgres
+`, server.URL)
+	requirementsDigest, err := requirementsDigest(requirements)
+	require.NoError(t, err)
+
+	vendoredPostgres := UpstreamFile{Path: "charts/postgres-2.0.0.tgz", Content: []byte("vendored")}
+
+	tests := []struct {
+		name              string
+		files             []UpstreamFile
+		expectedArchive   string
+		expectedContent   []byte
+		expectedLockCount int
+		expectErr         bool
+	}{
+		{
+			name: "no requirements",
+			files: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+			},
+		},
+		{
+			name: "resolves constraint",
+			files: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+				{Path: "requirements.yaml", Content: []byte(requirements)},
+				vendoredPostgres,
+			},
+			expectedArchive:   "charts/redis-1.0.0.tgz",
+			expectedContent:   redis100,
+			expectedLockCount: 2,
+		},
+		{
+			name: "honors matching lock",
+			files: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+				{Path: "requirements.yaml", Content: []byte(requirements)},
+				{Path: "requirements.lock", Content: []byte(fmt.Sprintf("digest: %s\ndependencies:\n- name: redis\n  version: 1.1.0\n", requirementsDigest))},
+				vendoredPostgres,
+			},
+			expectedArchive:   "charts/redis-1.1.0.tgz",
+			expectedContent:   redis110,
+			expectedLockCount: 2,
+		},
+		{
+			name: "ignores stale lock",
+			files: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+				{Path: "requirements.yaml", Content: []byte(requirements)},
+				{Path: "requirements.lock", Content: []byte("digest: sha256:stale\ndependencies:\n- name: redis\n  version: 1.1.0\n")},
+				vendoredPostgres,
+			},
+			expectedArchive:   "charts/redis-1.0.0.tgz",
+			expectedContent:   redis100,
+			expectedLockCount: 2,
+		},
+		{
+			name: "already vendored",
+			files: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+				{Path: "requirements.yaml", Content: []byte(requirements)},
+				{Path: "charts/redis/Chart.yaml", Content: []byte("name: redis\nversion: 1.0.0")},
+				vendoredPostgres,
+			},
+			expectedLockCount: 2,
+		},
+		{
+			name: "local dependency not vendored",
+			files: []UpstreamFile{
+				{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+				{Path: "requirements.yaml", Content: []byte(requirements)},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			cacheDir, err := ioutil.TempDir("", "kots")
+			req.NoError(err)
+			defer os.RemoveAll(cacheDir)
+
+			files, err := vendorHelmDependencies(test.files, "", &FetchOptions{CacheDir: cacheDir})
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+
+			filesByPath := map[string][]byte{}
+			for _, file := range files {
+				filesByPath[file.Path] = file.Content
+			}
+
+			if test.expectedArchive != "" {
+				assert.Equal(t, test.expectedContent, filesByPath[test.expectedArchive])
+			}
+
+			lockContent, ok := filesByPath["requirements.lock"]
+			if test.expectedLockCount == 0 {
+				assert.False(t, ok)
+				return
+			}
+			req.True(ok)
+
+			lock := chartutil.RequirementsLock{}
+			req.NoError(yaml.Unmarshal(lockContent, &lock))
+			assert.Equal(t, requirementsDigest, lock.Digest)
+			assert.Len(t, lock.Dependencies, test.expectedLockCount)
+		})
+	}
+}
+
+func Test_vendorHelmDependencyAliases(t *testing.T) {
+	req := require.New(t)
+
+	redis100 := mustCreateTarGz(t, map[string]string{"redis/Chart.yaml": "name: redis\nversion: 1.0.0"})
+	redis110 := mustCreateTarGz(t, map[string]string{"redis/Chart.yaml": "name: redis\nversion: 1.1.0"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprint(w, `apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 1.1.0
+    urls:
+    - redis-1.1.0.tgz
+  - name: redis
+    version: 1.0.0
+    urls:
+    - redis-1.0.0.tgz
+`)
+		case "/redis-1.0.0.tgz":
+			w.Write(redis100)
+		case "/redis-1.1.0.tgz":
+			w.Write(redis110)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	requirements := fmt.Sprintf(`dependencies:
+- name: redis
+  version: ~1.0.0
+  repository: %[1]s
+  alias: cache
+- name: redis
+  version: ~1.1.0
+  repository: %[1]s
+  alias: sessions
+- name: redis
+  version: ~1.0.0
+  repository: %[1]s
+  alias: queue
+`, server.URL)
+	digest, err := requirementsDigest(requirements)
+	req.NoError(err)
+
+	cacheDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(cacheDir)
+
+	files, err := vendorHelmDependencies([]UpstreamFile{
+		{Path: "Chart.yaml", Content: []byte("name: app\nversion: 0.1.0")},
+		{Path: "requirements.yaml", Content: []byte(requirements)},
+		// helm doesn't record aliases in the lock
+		{Path: "requirements.lock", Content: []byte(fmt.Sprintf(`digest: %s
+dependencies:
+- name: redis
+  version: 1.0.0
+- name: redis
+  version: 1.1.0
+- name: redis
+  version: 1.0.0
+`, digest))},
+	}, "", &FetchOptions{CacheDir: cacheDir})
+	req.NoError(err)
+
+	filesByPath := map[string][]byte{}
+	archives := []string{}
+	for _, file := range files {
+		filesByPath[file.Path] = file.Content
+		if path.Dir(file.Path) == "charts" {
+			archives = append(archives, file.Path)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"charts/redis-1.0.0.tgz", "charts/redis-1.1.0.tgz"}, archives)
+	assert.Equal(t, redis100, filesByPath["charts/redis-1.0.0.tgz"])
+	assert.Equal(t, redis110, filesByPath["charts/redis-1.1.0.tgz"])
+
+	lock := chartutil.RequirementsLock{}
+	req.NoError(yaml.Unmarshal(filesByPath["requirements.lock"], &lock))
+	req.Len(lock.Dependencies, 3)
+	assert.Equal(t, "cache", lock.Dependencies[0].Alias)
+	assert.Equal(t, "1.0.0", lock.Dependencies[0].Version)
+	assert.Equal(t, "sessions", lock.Dependencies[1].Alias)
+	assert.Equal(t, "1.1.0", lock.Dependencies[1].Version)
+	assert.Equal(t, "queue", lock.Dependencies[2].Alias)
+	assert.Equal(t, "1.0.0", lock.Dependencies[2].Version)
+}
+
+func requirementsDigest(requirements string) (string, error) {
+	r := chartutil.Requirements{}
+	if err := yaml.Unmarshal([]byte(requirements), &r); err != nil {
+		return "", err
+	}
+
+	return resolver.HashReq(&r)
+}
@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/httpclient"
+)
+
+// helmHTTPGetter makes requests to helm repos with the credentials and tls settings
+// (including insecure skip verify, which helm v2 does not support) from the fetch
+// options applied to every request, the index download and the chart download alike.
+// The credentials are only sent to the repo host, charts in the index can be
+// anywhere, like helm does without --pass-credentials.
+type helmHTTPGetter struct {
+	client   *http.Client
+	repoURL  *url.URL
+	username string
+	password string
+}
+
+func newHelmHTTPGetter(repoURI string, fetchOptions *FetchOptions) (*helmHTTPGetter, error) {
+	repoURL, err := url.Parse(repoURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse repo uri")
+	}
+
+	transport, err := httpclient.NewTransport(fetchOptions.HTTPClientOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create transport")
+	}
+	transport.DisableCompression = true
+
+	if err := applyHelmRepoTLSConfig(transport.TLSClientConfig, fetchOptions); err != nil {
+		return nil, errors.Wrap(err, "failed to create tls config")
+	}
+
+	g := &helmHTTPGetter{
+		client:   httpclient.NewWithTransport(transport, fetchOptions.HTTPClientOptions),
+		repoURL:  repoURL,
+		username: fetchOptions.HelmRepoUsername,
+		password: fetchOptions.HelmRepoPassword,
+	}
+
+	return g, nil
+}
+
+func (g *helmHTTPGetter) Get(href string) ([]byte, error) {
+	resp, err := g.do(href, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch %s: %s", href, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	return body, nil
+}
+
+// do sends a get request with the additional headers. The caller is responsible
+// for checking the status and closing the body.
+func (g *helmHTTPGetter) do(href string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call newrequest")
+	}
+
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	if (g.username != "" || g.password != "") && g.isRepoURL(req.URL) {
+		req.SetBasicAuth(g.username, g.password)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute get request")
+	}
+
+	return resp, nil
+}
+
+// isRepoURL returns true when the url has the same scheme and host as the repo
+func (g *helmHTTPGetter) isRepoURL(u *url.URL) bool {
+	return strings.EqualFold(u.Scheme, g.repoURL.Scheme) && strings.EqualFold(u.Host, g.repoURL.Host)
+}
+
+// applyHelmRepoTLSConfig adds the helm repo tls settings to the tls config from the
+// http client options. The helm repo ca is trusted in addition to any other cas.
+func applyHelmRepoTLSConfig(tlsConfig *tls.Config, fetchOptions *FetchOptions) error {
+	tlsConfig.InsecureSkipVerify = fetchOptions.HelmRepoInsecureSkipVerify
+
+	if fetchOptions.HelmRepoCertFile != "" || fetchOptions.HelmRepoKeyFile != "" {
+		if fetchOptions.HelmRepoCertFile == "" || fetchOptions.HelmRepoKeyFile == "" {
+			return errors.New("both a cert file and a key file are required for client certificates")
+		}
+
+		cert, err := tls.LoadX509KeyPair(fetchOptions.HelmRepoCertFile, fetchOptions.HelmRepoKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if fetchOptions.HelmRepoCAFile != "" {
+		caData, err := ioutil.ReadFile(fetchOptions.HelmRepoCAFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read ca file")
+		}
+
+		certPool := tlsConfig.RootCAs
+		if certPool == nil {
+			certPool = x509.NewCertPool()
+		}
+		if !certPool.AppendCertsFromPEM(caData) {
+			return errors.Errorf("no certificates found in %s", fetchOptions.HelmRepoCAFile)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	return nil
+}
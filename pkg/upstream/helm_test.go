@@ -1,7 +1,13 @@
 package upstream
 
 import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +36,20 @@ func Test_parseHelmURL(t *testing.T) {
 			expectedChartName:    "mysql",
 			expectedChartVersion: "1.3.1",
 		},
+		{
+			name:                 "stable/redis@~8.1",
+			uri:                  "helm://stable/redis@~8.1",
+			expectedRepo:         "stable",
+			expectedChartName:    "redis",
+			expectedChartVersion: "~8.1",
+		},
+		{
+			name:                 "quoted range",
+			uri:                  `helm://stable/redis@">=1.0 <2.0"`,
+			expectedRepo:         "stable",
+			expectedChartName:    "redis",
+			expectedChartVersion: ">=1.0 <2.0",
+		},
 	}
 
 	for _, test := range tests {
@@ -47,3 +67,268 @@ func Test_parseHelmURL(t *testing.T) {
 		})
 	}
 }
+
+func Test_resolveChartVersion(t *testing.T) {
+	availableVersions := []string{"1.0.0", "1.2.0", "1.2.3", "1.3.0", "2.0.0-rc1", "1.2.4-beta.1", "0.9.0"}
+
+	tests := []struct {
+		name               string
+		versionSpec        string
+		includePrereleases bool
+		expected           string
+		expectErr          bool
+	}{
+		{
+			name:        "latest excludes prereleases",
+			versionSpec: "",
+			expected:    "1.3.0",
+		},
+		{
+			name:               "latest includes prereleases",
+			versionSpec:        "",
+			includePrereleases: true,
+			expected:           "2.0.0-rc1",
+		},
+		{
+			name:        "exact",
+			versionSpec: "1.2.0",
+			expected:    "1.2.0",
+		},
+		{
+			name:        "exact prerelease",
+			versionSpec: "2.0.0-rc1",
+			expected:    "2.0.0-rc1",
+		},
+		{
+			name:        "exact not found",
+			versionSpec: "1.2.5",
+			expectErr:   true,
+		},
+		{
+			name:        "patch updates only",
+			versionSpec: "~1.2",
+			expected:    "1.2.3",
+		},
+		{
+			name:               "patch updates with prereleases",
+			versionSpec:        "~1.2",
+			includePrereleases: true,
+			expected:           "1.2.4-beta.1",
+		},
+		{
+			name:               "prerelease is below its release",
+			versionSpec:        "<2.0.0",
+			includePrereleases: true,
+			expected:           "2.0.0-rc1",
+		},
+		{
+			name:               "prerelease is not at or above its release",
+			versionSpec:        ">=2.0.0",
+			includePrereleases: true,
+			expectErr:          true,
+		},
+		{
+			name:               "prerelease is above the previous release",
+			versionSpec:        ">1.3.0",
+			includePrereleases: true,
+			expected:           "2.0.0-rc1",
+		},
+		{
+			name:        "prerelease excluded from range",
+			versionSpec: "<2.0.0",
+			expected:    "1.3.0",
+		},
+		{
+			name:        "space separated range",
+			versionSpec: ">=1.0 <1.3",
+			expected:    "1.2.3",
+		},
+		{
+			name:        "comma separated range",
+			versionSpec: ">= 1.0, < 1.3",
+			expected:    "1.2.3",
+		},
+		{
+			name:        "no match",
+			versionSpec: "^3.0",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			actual, err := resolveChartVersion(availableVersions, test.versionSpec, test.includePrereleases)
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func Test_newerChartVersions(t *testing.T) {
+	availableVersions := []string{"1.0.0", "1.2.0", "1.2.3", "1.3.0", "2.0.0-rc1", "1.2.4-beta.1", "0.9.0"}
+
+	tests := []struct {
+		name               string
+		currentVersion     string
+		versionSpec        string
+		includePrereleases bool
+		expected           []string
+	}{
+		{
+			name:           "newer versions",
+			currentVersion: "1.2.0",
+			expected:       []string{"1.2.3", "1.3.0"},
+		},
+		{
+			name:               "newer versions with prereleases",
+			currentVersion:     "1.2.0",
+			includePrereleases: true,
+			expected:           []string{"1.2.3", "1.2.4-beta.1", "1.3.0", "2.0.0-rc1"},
+		},
+		{
+			name:           "pinned to an exact version",
+			currentVersion: "1.2.0",
+			versionSpec:    "1.2.0",
+			expected:       []string{"1.2.3", "1.3.0"},
+		},
+		{
+			name:           "limited by constraint",
+			currentVersion: "1.2.0",
+			versionSpec:    "~1.2",
+			expected:       []string{"1.2.3"},
+		},
+		{
+			name:           "latest",
+			currentVersion: "1.3.0",
+			expected:       []string{},
+		},
+		{
+			name:     "nothing pulled",
+			expected: []string{"0.9.0", "1.0.0", "1.2.0", "1.2.3", "1.3.0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			actual, err := newerChartVersions(availableVersions, test.currentVersion, test.versionSpec, test.includePrereleases)
+			req.NoError(err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func Test_downloadHelmAuthenticated(t *testing.T) {
+	req := require.New(t)
+
+	chart := mustCreateTarGz(t, map[string]string{
+		"mychart/Chart.yaml":  "name: mychart\nversion: 0.1.0",
+		"mychart/values.yaml": "replicas: 1",
+	})
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprintf(w, `apiVersion: v1
+entries:
+  mychart:
+  - name: mychart
+    version: 0.1.0
+    urls:
+    - %s/mychart-0.1.0.tgz
+`, server.URL)
+		case "/mychart-0.1.0.tgz":
+			w.Write(chart)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	caFile, err := ioutil.TempFile("", "kots")
+	req.NoError(err)
+	defer os.Remove(caFile.Name())
+	err = pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	req.NoError(err)
+	req.NoError(caFile.Close())
+
+	u, err := url.ParseRequestURI("helm://private/mychart@0.1.0")
+	req.NoError(err)
+
+	tests := []struct {
+		name         string
+		fetchOptions FetchOptions
+		expectErr    bool
+	}{
+		{
+			name: "ca file and credentials",
+			fetchOptions: FetchOptions{
+				HelmRepoURI:      server.URL,
+				HelmRepoUsername: "user",
+				HelmRepoPassword: "pass",
+				HelmRepoCAFile:   caFile.Name(),
+			},
+		},
+		{
+			name: "insecure skip verify and credentials",
+			fetchOptions: FetchOptions{
+				HelmRepoURI:                server.URL,
+				HelmRepoUsername:           "user",
+				HelmRepoPassword:           "pass",
+				HelmRepoInsecureSkipVerify: true,
+			},
+		},
+		{
+			name: "untrusted certificate",
+			fetchOptions: FetchOptions{
+				HelmRepoURI:      server.URL,
+				HelmRepoUsername: "user",
+				HelmRepoPassword: "pass",
+			},
+			expectErr: true,
+		},
+		{
+			name: "no credentials",
+			fetchOptions: FetchOptions{
+				HelmRepoURI:    server.URL,
+				HelmRepoCAFile: caFile.Name(),
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			cacheDir, err := ioutil.TempDir("", "kots")
+			req.NoError(err)
+			defer os.RemoveAll(cacheDir)
+			test.fetchOptions.CacheDir = cacheDir
+
+			upstream, err := downloadHelm(u, &test.fetchOptions)
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			assert.Equal(t, "mychart", upstream.Name)
+			assert.Equal(t, "0.1.0", upstream.UpdateCursor)
+			assert.Len(t, upstream.Files, 2)
+		})
+	}
+}
@@ -1,9 +1,227 @@
 package upstream
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/archive"
+	"github.com/replicatedhq/kots/pkg/util"
+)
+
+const (
+	httpFormatTarGz = "tar.gz"
+	httpFormatTar   = "tar"
+	httpFormatZip   = "zip"
+	httpFormatYAML  = "yaml"
 )
 
-func downloadHttp(httpURI string) (*Upstream, error) {
-	return nil, errors.New("not implemented")
+type httpProvider struct{}
+
+func (httpProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	return true, nil
+}
+
+func (httpProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return downloadHttp(client, u)
+}
+
+func (p httpProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	return checkForUpdatesByListing(p, u, currentCursor, fetchOptions)
+}
+
+// ListUpdates makes a conditional request with the current cursor, so that the
+// content only has to be downloaded when the server doesn't support it. There is
+// no history, so the only update is the current content.
+func (httpProvider) ListUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) ([]Update, error) {
+	getReq, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call newrequest")
+	}
+
+	if strings.HasPrefix(currentCursor, `"`) || strings.HasPrefix(currentCursor, `W/"`) {
+		getReq.Header.Set("If-None-Match", currentCursor)
+	} else if _, err := http.ParseTime(currentCursor); err == nil {
+		getReq.Header.Set("If-Modified-Since", currentCursor)
+	}
+
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	getResp, err := client.Do(getReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute get request")
+	}
+	defer getResp.Body.Close()
+
+	if getResp.StatusCode == http.StatusNotModified {
+		return []Update{}, nil
+	}
+
+	if getResp.StatusCode >= 400 {
+		return nil, errors.Errorf("unexpected result from get request: %d", getResp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(getResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	updateCursor := httpUpdateCursor(getResp.Header, body)
+	if updateCursor == currentCursor {
+		return []Update{}, nil
+	}
+
+	return []Update{
+		{
+			Cursor: updateCursor,
+		},
+	}, nil
+}
+
+func downloadHttp(client *http.Client, u *url.URL) (*Upstream, error) {
+	getReq, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call newrequest")
+	}
+
+	getResp, err := client.Do(getReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute get request")
+	}
+	defer getResp.Body.Close()
+
+	if getResp.StatusCode >= 400 {
+		return nil, errors.Errorf("unexpected result from get request: %d", getResp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(getResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	fileName := path.Base(u.Path)
+	if fileName == "." || fileName == "/" {
+		fileName = ""
+	}
+
+	var files []UpstreamFile
+	switch detectHttpFormat(getResp.Header.Get("Content-Type"), fileName) {
+	case httpFormatTarGz:
+		files, err = readTarGzFromReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tar gz")
+		}
+	case httpFormatTar:
+		files, err = readTarFromReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tar")
+		}
+	case httpFormatZip:
+		files, err = readZip(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read zip")
+		}
+	default:
+		yamlFileName := fileName
+		if yamlFileName == "" {
+			yamlFileName = "manifest.yaml"
+		}
+		files = []UpstreamFile{
+			{
+				Path:    yamlFileName,
+				Content: body,
+			},
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no files found in response")
+	}
+
+	upstream := &Upstream{
+		URI:          util.RemoveURLCredentials(u.String()),
+		Name:         httpUpstreamName(u, fileName),
+		Type:         upstreamTypeFromFiles(files),
+		Files:        files,
+		UpdateCursor: httpUpdateCursor(getResp.Header, body),
+	}
+
+	return upstream, nil
+}
+
+// detectHttpFormat uses the content type to determine the format of the response,
+// falling back to the file extension when the server returns a generic type
+func detectHttpFormat(contentType string, fileName string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		switch mediaType {
+		case "application/gzip", "application/x-gzip", "application/x-compressed-tar":
+			return httpFormatTarGz
+		case "application/x-tar":
+			return httpFormatTar
+		case "application/zip", "application/x-zip-compressed":
+			return httpFormatZip
+		case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+			return httpFormatYAML
+		}
+	}
+
+	if isTarGzFilename(fileName) {
+		return httpFormatTarGz
+	}
+	if strings.HasSuffix(strings.ToLower(fileName), ".tar") {
+		return httpFormatTar
+	}
+	if strings.HasSuffix(strings.ToLower(fileName), ".zip") {
+		return httpFormatZip
+	}
+
+	return httpFormatYAML
+}
+
+// httpUpdateCursor prefers the ETag, then Last-Modified. If the server returns
+// neither, a hash of the content is used so that changes are still detected.
+func httpUpdateCursor(header http.Header, body []byte) string {
+	if etag := header.Get("ETag"); etag != "" {
+		return etag
+	}
+
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		return lastModified
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(body))
+}
+
+func httpUpstreamName(u *url.URL, fileName string) string {
+	name := trimArchiveExtension(fileName)
+	if name == "" {
+		name = u.Hostname()
+	}
+
+	return name
+}
+
+func readZip(content []byte) ([]UpstreamFile, error) {
+	files, err := archive.ReadZip(content, archive.Options{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read zip archive")
+	}
+
+	return upstreamFilesFromArchive(files), nil
 }
@@ -0,0 +1,259 @@
+package upstream
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_detectHttpFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		fileName    string
+		expected    string
+	}{
+		{
+			name:        "gzip content type",
+			contentType: "application/gzip",
+			fileName:    "release",
+			expected:    httpFormatTarGz,
+		},
+		{
+			name:        "zip content type with params",
+			contentType: "application/zip; charset=binary",
+			fileName:    "",
+			expected:    httpFormatZip,
+		},
+		{
+			name:        "tar content type",
+			contentType: "application/x-tar",
+			fileName:    "release",
+			expected:    httpFormatTar,
+		},
+		{
+			name:        "octet stream tar",
+			contentType: "application/octet-stream",
+			fileName:    "app.tar",
+			expected:    httpFormatTar,
+		},
+		{
+			name:        "octet stream tgz",
+			contentType: "application/octet-stream",
+			fileName:    "app-1.0.0.tgz",
+			expected:    httpFormatTarGz,
+		},
+		{
+			name:        "octet stream zip",
+			contentType: "application/octet-stream",
+			fileName:    "app.ZIP",
+			expected:    httpFormatZip,
+		},
+		{
+			name:        "text yaml",
+			contentType: "text/plain",
+			fileName:    "install.yaml",
+			expected:    httpFormatYAML,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, detectHttpFormat(test.contentType, test.fileName))
+		})
+	}
+}
+
+func Test_downloadHttp(t *testing.T) {
+	req := require.New(t)
+
+	tarGzContent := mustCreateTarGz(t, map[string]string{
+		"app/deployment.yaml": "kind: Deployment",
+		"app/service.yaml":    "kind: Service",
+	})
+	tarContent := mustCreateTar(t, map[string]string{
+		"app/deployment.yaml": "kind: Deployment",
+	})
+	zipContent := mustCreateZip(t, map[string]string{
+		"chart/Chart.yaml":  "name: mychart",
+		"chart/values.yaml": "replicas: 1",
+	})
+	zipSlipContent := mustCreateZip(t, map[string]string{
+		"app/deployment.yaml": "kind: Deployment",
+		"../../escaped.yaml":  "kind: Service",
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/app.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"abc123"`)
+		w.Write(tarGzContent)
+	})
+	mux.HandleFunc("/releases/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write(zipContent)
+	})
+	mux.HandleFunc("/releases/tar", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Write(tarContent)
+	})
+	mux.HandleFunc("/releases/escaped.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipSlipContent)
+	})
+	mux.HandleFunc("/install.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/yaml")
+		w.Write([]byte("kind: Deployment\n---\nkind: Service"))
+	})
+	mux.HandleFunc("/missing.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	u, err := url.ParseRequestURI(server.URL + "/releases/app.tar.gz")
+	req.NoError(err)
+	upstream, err := downloadHttp(http.DefaultClient, u)
+	req.NoError(err)
+	assert.Equal(t, "app", upstream.Name)
+	assert.Equal(t, "plain", upstream.Type)
+	assert.Equal(t, `"abc123"`, upstream.UpdateCursor)
+	assert.ElementsMatch(t, []UpstreamFile{
+		{Path: "deployment.yaml", Content: []byte("kind: Deployment")},
+		{Path: "service.yaml", Content: []byte("kind: Service")},
+	}, upstream.Files)
+
+	u, err = url.ParseRequestURI(server.URL + "/releases/download")
+	req.NoError(err)
+	upstream, err = downloadHttp(http.DefaultClient, u)
+	req.NoError(err)
+	assert.Equal(t, "helm", upstream.Type)
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", upstream.UpdateCursor)
+	assert.ElementsMatch(t, []UpstreamFile{
+		{Path: "Chart.yaml", Content: []byte("name: mychart")},
+		{Path: "values.yaml", Content: []byte("replicas: 1")},
+	}, upstream.Files)
+
+	u, err = url.ParseRequestURI(server.URL + "/releases/tar")
+	req.NoError(err)
+	upstream, err = downloadHttp(http.DefaultClient, u)
+	req.NoError(err)
+	assert.Equal(t, []UpstreamFile{
+		{Path: "deployment.yaml", Content: []byte("kind: Deployment")},
+	}, upstream.Files)
+
+	u, err = url.ParseRequestURI(server.URL + "/releases/escaped.zip")
+	req.NoError(err)
+	_, err = downloadHttp(http.DefaultClient, u)
+	req.Error(err)
+	assert.Contains(t, err.Error(), "outside of the archive root")
+
+	u, err = url.ParseRequestURI(server.URL + "/install.yaml")
+	req.NoError(err)
+	upstream, err = downloadHttp(http.DefaultClient, u)
+	req.NoError(err)
+	assert.Equal(t, "install", upstream.Name)
+	assert.NotEmpty(t, upstream.UpdateCursor)
+	assert.Equal(t, []UpstreamFile{
+		{Path: "install.yaml", Content: []byte("kind: Deployment\n---\nkind: Service")},
+	}, upstream.Files)
+
+	u, err = url.ParseRequestURI(server.URL + "/missing.yaml")
+	req.NoError(err)
+	_, err = downloadHttp(http.DefaultClient, u)
+	req.Error(err)
+}
+
+func Test_httpListUpdates(t *testing.T) {
+	req := require.New(t)
+
+	etag := `"abc123"`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/etag.yaml", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("kind: Deployment"))
+	})
+	mux.HandleFunc("/plain.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("kind: Deployment"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	u, err := url.ParseRequestURI(server.URL + "/etag.yaml")
+	req.NoError(err)
+
+	updates, err := httpProvider{}.ListUpdates(u, etag, &FetchOptions{})
+	req.NoError(err)
+	assert.Empty(t, updates)
+
+	updates, err = httpProvider{}.ListUpdates(u, `"old"`, &FetchOptions{})
+	req.NoError(err)
+	assert.Equal(t, []Update{{Cursor: etag}}, updates)
+
+	// without validators, the content hash is compared
+	u, err = url.ParseRequestURI(server.URL + "/plain.yaml")
+	req.NoError(err)
+
+	upstream, err := downloadHttp(http.DefaultClient, u)
+	req.NoError(err)
+
+	updates, err = httpProvider{}.ListUpdates(u, upstream.UpdateCursor, &FetchOptions{})
+	req.NoError(err)
+	assert.Empty(t, updates)
+}
+
+func mustCreateTarGz(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	gzw := gzip.NewWriter(&b)
+	_, err := gzw.Write(mustCreateTar(t, files))
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	return b.Bytes()
+}
+
+func mustCreateTar(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		require.NoError(t, err)
+		_, err = tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	return b.Bytes()
+}
+
+func mustCreateZip(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	return b.Bytes()
+}
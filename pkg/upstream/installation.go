@@ -0,0 +1,33 @@
+package upstream
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/pkg/errors"
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ReadInstallation returns the installation that was written with the upstream when
+// the app was pulled into the app dir
+func ReadInstallation(appDir string) (*kotsv1beta1.Installation, error) {
+	content, err := ioutil.ReadFile(path.Join(appDir, "upstream", "userdata", "installation.yaml"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read installation")
+	}
+
+	kotsscheme.AddToScheme(scheme.Scheme)
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, gvk, err := decode(content, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode installation")
+	}
+
+	if gvk.Group != "kots.io" || gvk.Version != "v1beta1" || gvk.Kind != "Installation" {
+		return nil, errors.New("not an installation")
+	}
+
+	return obj.(*kotsv1beta1.Installation), nil
+}
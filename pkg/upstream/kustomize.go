@@ -0,0 +1,195 @@
+package upstream
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/util"
+)
+
+// KustomizeBuildFilename is the file in a kustomize upstream that has the output
+// of building the kustomization
+const KustomizeBuildFilename = "kustomize-build.yaml"
+
+// kustomizationFilenames are the files that kustomize recognizes as a kustomization
+var kustomizationFilenames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// KustomizeBuildFunc builds the kustomization at a local directory or a remote
+// target, returning the resources as a multi doc yaml
+type KustomizeBuildFunc func(kustomizeTarget string) ([]byte, error)
+
+var (
+	kustomizeBuild   KustomizeBuildFunc
+	kustomizeBuildMu sync.RWMutex
+)
+
+// RegisterKustomizeBuild sets the function that kustomize upstreams are built with.
+// It's registered by pkg/kustomize, which keeps the kustomize build dependencies out
+// of this package.
+func RegisterKustomizeBuild(build KustomizeBuildFunc) {
+	kustomizeBuildMu.Lock()
+	defer kustomizeBuildMu.Unlock()
+
+	kustomizeBuild = build
+}
+
+// kustomizeProvider handles kustomize remote targets, written the same way as they
+// are for kustomize build, such as kustomize://github.com/org/repo//overlay?ref=v1.0.0.
+// The scheme can be left off remote targets. A local kustomization can be referred to
+// with kustomize:///path/to/overlay.
+type kustomizeProvider struct{}
+
+func (kustomizeProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	kustomizeTarget, _ := parseKustomizeURL(u)
+	if u.Host == "" {
+		return kustomizeTarget != "" && kustomizeTarget != "/", nil
+	}
+
+	return isKustomizeRemoteTarget(kustomizeTarget), nil
+}
+
+func (kustomizeProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	return downloadKustomize(u)
+}
+
+func (p kustomizeProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	return checkForUpdatesByFetching(p, u, currentCursor, fetchOptions)
+}
+
+func downloadKustomize(u *url.URL) (*Upstream, error) {
+	kustomizeTarget, name := parseKustomizeURL(u)
+	if kustomizeTarget == "" || kustomizeTarget == "/" {
+		return nil, errors.New("kustomize uri has no target")
+	}
+
+	upstream, err := buildKustomizeUpstream(kustomizeTarget, name)
+	if err != nil {
+		return nil, err
+	}
+	upstream.URI = util.RemoveURLCredentials(u.String())
+
+	return upstream, nil
+}
+
+// kustomizeRemoteTargetURI returns the kustomize uri for a remote target written
+// without a scheme, such as github.com/org/repo//overlay?ref=v1.0.0. Uris that aren't
+// remote targets are returned unchanged.
+func kustomizeRemoteTargetURI(upstreamURI string) string {
+	if util.IsURL(upstreamURI) || !isKustomizeRemoteTarget(upstreamURI) {
+		return upstreamURI
+	}
+
+	// a local path that happens to look like a remote target is read from disk
+	if _, err := os.Stat(upstreamURI); err == nil {
+		return upstreamURI
+	}
+
+	return "kustomize://" + upstreamURI
+}
+
+// isKustomizeRemoteTarget returns true if the target is a host followed by at least
+// the org and repo, which is the form kustomize build accepts for remote targets
+func isKustomizeRemoteTarget(kustomizeTarget string) bool {
+	repoPath := kustomizeTarget
+	if i := strings.Index(repoPath, "?"); i != -1 {
+		repoPath = repoPath[:i]
+	}
+	if i := strings.Index(repoPath, "//"); i != -1 {
+		repoPath = repoPath[:i]
+	}
+
+	parts := strings.Split(repoPath, "/")
+	if len(parts) < 3 {
+		return false
+	}
+
+	host := parts[0]
+	if host == "" || strings.HasPrefix(host, ".") || !strings.Contains(host, ".") {
+		return false
+	}
+
+	for _, part := range parts[1:] {
+		if part == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseKustomizeURL returns the target to pass to kustomize build, and the name of
+// the app, which is the repo name for remote targets
+func parseKustomizeURL(u *url.URL) (string, string) {
+	if u.Host == "" {
+		return u.Path, path.Base(u.Path)
+	}
+
+	kustomizeTarget := u.Host + u.Path
+	if u.RawQuery != "" {
+		kustomizeTarget = kustomizeTarget + "?" + u.RawQuery
+	}
+
+	repoPath := u.Host + u.Path
+	if i := strings.Index(repoPath, "//"); i != -1 {
+		repoPath = repoPath[:i]
+	}
+	name := strings.TrimSuffix(path.Base(repoPath), ".git")
+
+	return kustomizeTarget, name
+}
+
+// buildKustomizeUpstream builds the kustomization at the target and returns the
+// output as a kustomize upstream. The update cursor is a hash of the output, so only
+// changes to the output are updates.
+func buildKustomizeUpstream(kustomizeTarget string, name string) (*Upstream, error) {
+	kustomizeBuildMu.RLock()
+	build := kustomizeBuild
+	kustomizeBuildMu.RUnlock()
+
+	if build == nil {
+		return nil, errors.New("kustomize upstreams are not supported, no kustomize build is registered")
+	}
+
+	built, err := build(kustomizeTarget)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build kustomization")
+	}
+
+	files := []UpstreamFile{
+		{
+			Path:    KustomizeBuildFilename,
+			Content: built,
+		},
+	}
+
+	upstream := &Upstream{
+		URI:          util.RemoveURLCredentials(kustomizeTarget),
+		Name:         name,
+		Type:         "kustomize",
+		Files:        files,
+		UpdateCursor: contentHash(files),
+	}
+
+	return upstream, nil
+}
+
+// isKustomizationDir returns true if the directory has a kustomization file and is
+// not a helm chart
+func isKustomizationDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err == nil {
+		return false
+	}
+
+	for _, filename := range kustomizationFilenames {
+		if _, err := os.Stat(filepath.Join(dir, filename)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,450 @@
+package upstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/util"
+)
+
+const (
+	ociManifestMediaType       = "application/vnd.oci.image.manifest.v1+json"
+	helmChartLayerMediaType    = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	helmChartLayerMediaTypeOld = "application/tar+gzip"
+)
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociTagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// ociRegistry is a minimal client for the parts of the oci distribution api that
+// are needed to pull a helm chart
+type ociRegistry struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+type ociProvider struct{}
+
+func (ociProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	return true, nil
+}
+
+func (ociProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return downloadOCI(client, u, fetchOptions.includePrereleases())
+}
+
+// CheckForUpdates only lists tags, so the chart doesn't need to be downloaded
+func (ociProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	registryHost, repository, tag, err := parseOCIURL(u)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse oci uri")
+	}
+
+	if tag != "" {
+		return tag != currentCursor, nil
+	}
+
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return false, err
+	}
+
+	latestTag, err := newOCIRegistry(client, registryHost).latestSemverTag(repository, fetchOptions.includePrereleases())
+	if err != nil {
+		return false, errors.Wrap(err, "failed to find latest tag")
+	}
+
+	return latestTag != currentCursor, nil
+}
+
+// ListUpdates returns the semver tags that are newer than the current tag
+func (ociProvider) ListUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) ([]Update, error) {
+	registryHost, repository, _, err := parseOCIURL(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse oci uri")
+	}
+
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := newOCIRegistry(client, registryHost).listTags(repository)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tags")
+	}
+
+	newerTags, err := newerChartVersions(semverTags(tags), currentCursor, "", fetchOptions.includePrereleases())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find newer tags")
+	}
+
+	updates := []Update{}
+	for _, tag := range newerTags {
+		updates = append(updates, Update{
+			Cursor:       tag,
+			VersionLabel: tag,
+		})
+	}
+
+	return updates, nil
+}
+
+// semverTags returns the tags that are semver versions
+func semverTags(tags []string) []string {
+	versionTags := []string{}
+	for _, tag := range tags {
+		if _, err := semver.NewVersion(tag); err == nil {
+			versionTags = append(versionTags, tag)
+		}
+	}
+
+	return versionTags
+}
+
+func downloadOCI(client *http.Client, u *url.URL, includePrereleases bool) (*Upstream, error) {
+	registryHost, repository, tag, err := parseOCIURL(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse oci uri")
+	}
+
+	registry := newOCIRegistry(client, registryHost)
+
+	if tag == "" {
+		latestTag, err := registry.latestSemverTag(repository, includePrereleases)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find latest tag")
+		}
+		tag = latestTag
+	}
+
+	manifest, err := registry.getManifest(repository, tag)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get manifest")
+	}
+
+	var chartLayer *ociDescriptor
+	for i, layer := range manifest.Layers {
+		if layer.MediaType == helmChartLayerMediaType || layer.MediaType == helmChartLayerMediaTypeOld {
+			chartLayer = &manifest.Layers[i]
+			break
+		}
+	}
+	if chartLayer == nil {
+		return nil, errors.Errorf("no helm chart layer found in %s:%s", repository, tag)
+	}
+
+	blob, err := registry.getBlob(repository, *chartLayer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get chart layer")
+	}
+
+	files, err := readTarGzFromReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read chart archive")
+	}
+
+	upstream := &Upstream{
+		URI:          util.RemoveURLCredentials(u.String()),
+		Name:         path.Base(repository),
+		Type:         "helm",
+		Files:        files,
+		UpdateCursor: tag,
+	}
+
+	return upstream, nil
+}
+
+// parseOCIURL returns the registry host, the repository and the tag from an oci
+// uri (oci://registry/repo/chart:version). The tag is empty when not specified.
+func parseOCIURL(u *url.URL) (string, string, string, error) {
+	if u.Host == "" {
+		return "", "", "", errors.New("no registry in uri")
+	}
+
+	repository := strings.Trim(u.Path, "/")
+	tag := ""
+
+	lastSlash := strings.LastIndex(repository, "/")
+	if idx := strings.LastIndex(repository, ":"); idx > lastSlash {
+		tag = repository[idx+1:]
+		repository = repository[:idx]
+	}
+
+	if repository == "" {
+		return "", "", "", errors.New("no repository in uri")
+	}
+
+	return u.Host, repository, tag, nil
+}
+
+func newOCIRegistry(client *http.Client, registryHost string) *ociRegistry {
+	// like docker, registries on the local machine are assumed to not have tls
+	scheme := "https"
+	hostname := registryHost
+	if h, _, err := net.SplitHostPort(registryHost); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" || hostname == "127.0.0.1" {
+		scheme = "http"
+	}
+
+	return &ociRegistry{
+		client:  client,
+		baseURL: fmt.Sprintf("%s://%s", scheme, registryHost),
+	}
+}
+
+// latestSemverTag returns the highest tag that is a semver version. Prereleases are
+// only considered when includePrereleases is set, like chart versions in a helm repo.
+func (r *ociRegistry) latestSemverTag(repository string, includePrereleases bool) (string, error) {
+	tags, err := r.listTags(repository)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list tags")
+	}
+
+	var latest *semver.Version
+	latestTag := ""
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil {
+			// not every tag needs to be a chart version
+			continue
+		}
+		if v.Prerelease() != "" && !includePrereleases {
+			continue
+		}
+
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+			latestTag = tag
+		}
+	}
+
+	if latestTag == "" {
+		return "", errors.Errorf("no semver tags found for %s", repository)
+	}
+
+	return latestTag, nil
+}
+
+func (r *ociRegistry) listTags(repository string) ([]string, error) {
+	body, err := r.get(fmt.Sprintf("/v2/%s/tags/list", repository), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	tagList := ociTagList{}
+	if err := json.Unmarshal(body, &tagList); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal tag list")
+	}
+
+	return tagList.Tags, nil
+}
+
+func (r *ociRegistry) getManifest(repository string, reference string) (*ociManifest, error) {
+	body, err := r.get(fmt.Sprintf("/v2/%s/manifests/%s", repository, reference), ociManifestMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := ociManifest{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal manifest")
+	}
+
+	return &manifest, nil
+}
+
+func (r *ociRegistry) getBlob(repository string, descriptor ociDescriptor) ([]byte, error) {
+	body, err := r.get(fmt.Sprintf("/v2/%s/blobs/%s", repository, descriptor.Digest), "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(descriptor.Digest, "sha256:") {
+		return nil, errors.Errorf("unsupported digest %q", descriptor.Digest)
+	}
+	actualDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	if actualDigest != descriptor.Digest {
+		return nil, errors.Errorf("digest mismatch, expected %s, got %s", descriptor.Digest, actualDigest)
+	}
+
+	return body, nil
+}
+
+// get performs a get request against the registry. If the registry responds with a
+// bearer challenge, an anonymous token is requested and the request is retried.
+func (r *ociRegistry) get(requestPath string, accept string) ([]byte, error) {
+	resp, err := r.doGet(requestPath, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && r.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		token, err := r.fetchBearerToken(challenge)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get registry token")
+		}
+		r.token = token
+
+		resp, err = r.doGet(requestPath, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("unexpected result from get request to %s: %d", requestPath, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	return body, nil
+}
+
+func (r *ociRegistry) doGet(requestPath string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", r.baseURL+requestPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call newrequest")
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.token))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute get request")
+	}
+
+	return resp, nil
+}
+
+func (r *ociRegistry) fetchBearerToken(challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", errors.Errorf("unsupported auth challenge %q", challenge)
+	}
+
+	params := parseAuthChallengeParams(challenge[len("bearer "):])
+	realm, ok := params["realm"]
+	if !ok {
+		return "", errors.New("auth challenge has no realm")
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse realm")
+	}
+	query := tokenURL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if value, ok := params[key]; ok {
+			query.Set(key, value)
+		}
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	resp, err := r.client.Get(tokenURL.String())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to execute token request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", errors.Errorf("unexpected result from token request: %d", resp.StatusCode)
+	}
+
+	tokenResponse := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", errors.Wrap(err, "failed to decode token response")
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// parseAuthChallengeParams parses key="value" pairs from a WWW-Authenticate header
+func parseAuthChallengeParams(s string) map[string]string {
+	params := map[string]string{}
+
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		value := ""
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end == -1 {
+				value = s[1:]
+				s = ""
+			} else {
+				value = s[1 : end+1]
+				s = s[end+2:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end == -1 {
+				value = s
+				s = ""
+			} else {
+				value = s[:end]
+				s = s[end:]
+			}
+		}
+
+		params[key] = value
+	}
+
+	return params
+}
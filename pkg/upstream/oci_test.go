@@ -0,0 +1,185 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseOCIURL(t *testing.T) {
+	tests := []struct {
+		name               string
+		uri                string
+		expectedRegistry   string
+		expectedRepository string
+		expectedTag        string
+	}{
+		{
+			name:               "with tag",
+			uri:                "oci://registry.example.com/charts/redis:8.1.0",
+			expectedRegistry:   "registry.example.com",
+			expectedRepository: "charts/redis",
+			expectedTag:        "8.1.0",
+		},
+		{
+			name:               "registry with port, no tag",
+			uri:                "oci://localhost:5000/redis",
+			expectedRegistry:   "localhost:5000",
+			expectedRepository: "redis",
+			expectedTag:        "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			u, err := url.ParseRequestURI(test.uri)
+			req.NoError(err)
+
+			registry, repository, tag, err := parseOCIURL(u)
+			req.NoError(err)
+			assert.Equal(t, test.expectedRegistry, registry)
+			assert.Equal(t, test.expectedRepository, repository)
+			assert.Equal(t, test.expectedTag, tag)
+		})
+	}
+}
+
+// newTestOCIRegistry serves the chart archives as tags of a single repository,
+// requiring an anonymous bearer token like public registries do
+func newTestOCIRegistry(t *testing.T, repository string, charts map[string][]byte) *httptest.Server {
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+	tags := []string{"latest-build"}
+	for tag, chart := range charts {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(chart))
+		blobs[digest] = chart
+
+		manifest, err := json.Marshal(ociManifest{
+			SchemaVersion: 2,
+			Layers: []ociDescriptor{
+				{
+					MediaType: helmChartLayerMediaType,
+					Digest:    digest,
+					Size:      int64(len(chart)),
+				},
+			},
+		})
+		require.NoError(t, err)
+		manifests[tag] = manifest
+		tags = append(tags, tag)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(map[string]string{"token": "anonymous"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`, server.URL, repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		prefix := fmt.Sprintf("/v2/%s/", repository)
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+
+		switch {
+		case rest == "tags/list":
+			json.NewEncoder(w).Encode(ociTagList{Name: repository, Tags: tags})
+		case strings.HasPrefix(rest, "manifests/"):
+			manifest, ok := manifests[strings.TrimPrefix(rest, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			w.Write(manifest)
+		case strings.HasPrefix(rest, "blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(rest, "blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server
+}
+
+func Test_downloadOCI(t *testing.T) {
+	req := require.New(t)
+
+	server := newTestOCIRegistry(t, "charts/redis", map[string][]byte{
+		"8.0.0": mustCreateTarGz(t, map[string]string{
+			"redis/Chart.yaml": "name: redis\nversion: 8.0.0",
+		}),
+		"8.1.0": mustCreateTarGz(t, map[string]string{
+			"redis/Chart.yaml": "name: redis\nversion: 8.1.0",
+		}),
+		"9.0.0-rc1": mustCreateTarGz(t, map[string]string{
+			"redis/Chart.yaml": "name: redis\nversion: 9.0.0-rc1",
+		}),
+	})
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	req.NoError(err)
+	registryHost := fmt.Sprintf("localhost:%s", serverURL.Port())
+
+	u, err := url.ParseRequestURI(fmt.Sprintf("oci://%s/charts/redis:8.0.0", registryHost))
+	req.NoError(err)
+	upstream, err := downloadOCI(http.DefaultClient, u, false)
+	req.NoError(err)
+	assert.Equal(t, "redis", upstream.Name)
+	assert.Equal(t, "helm", upstream.Type)
+	assert.Equal(t, "8.0.0", upstream.UpdateCursor)
+	assert.Equal(t, []UpstreamFile{
+		{Path: "Chart.yaml", Content: []byte("name: redis\nversion: 8.0.0")},
+	}, upstream.Files)
+
+	u, err = url.ParseRequestURI(fmt.Sprintf("oci://%s/charts/redis", registryHost))
+	req.NoError(err)
+	upstream, err = downloadOCI(http.DefaultClient, u, false)
+	req.NoError(err)
+	assert.Equal(t, "8.1.0", upstream.UpdateCursor)
+
+	upstream, err = downloadOCI(http.DefaultClient, u, true)
+	req.NoError(err)
+	assert.Equal(t, "9.0.0-rc1", upstream.UpdateCursor)
+
+	hasUpdate, err := ociProvider{}.CheckForUpdates(u, "8.0.0", nil)
+	req.NoError(err)
+	assert.True(t, hasUpdate)
+
+	hasUpdate, err = ociProvider{}.CheckForUpdates(u, "8.1.0", nil)
+	req.NoError(err)
+	assert.False(t, hasUpdate)
+
+	hasUpdate, err = ociProvider{}.CheckForUpdates(u, "8.1.0", &FetchOptions{HelmIncludePrereleases: true})
+	req.NoError(err)
+	assert.True(t, hasUpdate)
+
+	u, err = url.ParseRequestURI(fmt.Sprintf("oci://%s/charts/redis:9.9.9", registryHost))
+	req.NoError(err)
+	_, err = downloadOCI(http.DefaultClient, u, false)
+	req.Error(err)
+}
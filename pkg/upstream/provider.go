@@ -0,0 +1,67 @@
+package upstream
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Provider knows how to fetch upstreams for a uri scheme. Providers are registered
+// with RegisterProvider and are used by FetchUpstream to handle uris with that scheme.
+type Provider interface {
+	// CanFetch returns true if the upstream is accessible with the fetch options
+	// provided (for example, replicated upstreams require a license).
+	CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error)
+
+	// Fetch downloads the upstream.
+	Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error)
+
+	// CheckForUpdates returns true if the upstream has changed since currentCursor.
+	CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error)
+}
+
+var (
+	providers   = map[string]Provider{}
+	providersMu sync.RWMutex
+)
+
+func init() {
+	RegisterProvider("helm", helmProvider{})
+	RegisterProvider("replicated", replicatedProvider{})
+	RegisterProvider("git", gitProvider{})
+	RegisterProvider("http", httpProvider{})
+	RegisterProvider("https", httpProvider{})
+	RegisterProvider("oci", ociProvider{})
+	RegisterProvider("kustomize", kustomizeProvider{})
+}
+
+// RegisterProvider makes a provider available for the uri scheme. Registering a
+// scheme that is already registered replaces the existing provider.
+func RegisterProvider(scheme string, provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[strings.ToLower(scheme)] = provider
+}
+
+// GetProvider returns the provider registered for the uri scheme, if any
+func GetProvider(scheme string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[strings.ToLower(scheme)]
+	return provider, ok
+}
+
+// checkForUpdatesByFetching is used by providers that have no cheaper way to
+// find the latest cursor than downloading the upstream
+func checkForUpdatesByFetching(p Provider, u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	upstream, err := p.Fetch(u, fetchOptions)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to fetch upstream")
+	}
+
+	return upstream.UpdateCursor != currentCursor, nil
+}
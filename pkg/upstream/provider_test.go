@@ -0,0 +1,93 @@
+package upstream
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProvider struct {
+	canFetch bool
+}
+
+func (p testProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	return p.canFetch, nil
+}
+
+func (testProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	return &Upstream{
+		URI:          u.String(),
+		Name:         u.Hostname(),
+		Type:         "plain",
+		UpdateCursor: "2",
+	}, nil
+}
+
+func (p testProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	return checkForUpdatesByFetching(p, u, currentCursor, fetchOptions)
+}
+
+// saveProviders returns a func that restores the registered providers to the ones
+// registered now, so that tests don't leave providers behind for other tests
+func saveProviders() func() {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	saved := map[string]Provider{}
+	for scheme, provider := range providers {
+		saved[scheme] = provider
+	}
+
+	return func() {
+		providersMu.Lock()
+		defer providersMu.Unlock()
+
+		providers = saved
+	}
+}
+
+func Test_RegisterProvider(t *testing.T) {
+	req := require.New(t)
+	defer saveProviders()()
+
+	_, err := FetchUpstream("artifacts://my-app/release", nil)
+	req.Error(err)
+
+	RegisterProvider("Artifacts", testProvider{canFetch: false})
+
+	upstream, err := FetchUpstream("artifacts://my-app/release", nil)
+	req.NoError(err)
+	assert.Equal(t, "my-app", upstream.Name)
+
+	canFetch, err := CanFetchUpstream("artifacts://my-app/release", nil)
+	req.NoError(err)
+	assert.False(t, canFetch)
+
+	provider, ok := GetProvider("artifacts")
+	req.True(ok)
+
+	u, err := url.ParseRequestURI("artifacts://my-app/release")
+	req.NoError(err)
+
+	hasUpdate, err := provider.CheckForUpdates(u, "1", nil)
+	req.NoError(err)
+	assert.True(t, hasUpdate)
+
+	hasUpdate, err = provider.CheckForUpdates(u, "2", nil)
+	req.NoError(err)
+	assert.False(t, hasUpdate)
+
+	// providers that can't list updates are fetched instead
+	updates, err := ListUpdates("artifacts://my-app/release", "1", nil)
+	req.NoError(err)
+	assert.Equal(t, []Update{{Cursor: "2"}}, updates)
+}
+
+func Test_builtinProviders(t *testing.T) {
+	for _, scheme := range []string{"helm", "replicated", "git", "http", "https", "oci"} {
+		_, ok := GetProvider(scheme)
+		assert.True(t, ok, scheme)
+	}
+}
@@ -1,23 +1,24 @@
 package upstream
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"encoding/base64"
+	stdjson "encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
 	kotsscheme "github.com/replicatedhq/kots/kotskinds/client/kotsclientset/scheme"
+	"github.com/replicatedhq/kots/pkg/archive"
 	"github.com/replicatedhq/kots/pkg/template"
 	"github.com/replicatedhq/kots/pkg/util"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -47,11 +48,99 @@ type App struct {
 type Release struct {
 	UpdateCursor string
 	VersionLabel string
+	ReleaseNotes string
+	ReleasedAt   *time.Time
+	ChannelName  string
 	Manifests    map[string][]byte
 }
 
-func downloadReplicated(u *url.URL, localPath string, license *kotsv1beta1.License) (*Upstream, error) {
+type replicatedProvider struct{}
+
+// CanFetch is a shortcut that avoids http checks, because all replicated:// app
+// types require a license to pull
+func (replicatedProvider) CanFetch(u *url.URL, fetchOptions *FetchOptions) (bool, error) {
+	return fetchOptions.License != nil, nil
+}
+
+func (replicatedProvider) Fetch(u *url.URL, fetchOptions *FetchOptions) (*Upstream, error) {
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return downloadReplicated(client, u, fetchOptions.LocalPath, fetchOptions.License)
+}
+
+func (p replicatedProvider) CheckForUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	return checkForUpdatesByListing(p, u, currentCursor, fetchOptions)
+}
+
+// ListUpdates returns the releases that have been promoted to the channel after the
+// current sequence. Servers that can't list pending releases are asked for the head
+// of the channel instead.
+func (replicatedProvider) ListUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) ([]Update, error) {
+	if fetchOptions.License == nil {
+		return nil, errors.New("No license was provided")
+	}
+
+	replicatedUpstream, err := parseReplicatedURL(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse replicated upstream")
+	}
+
+	client, err := fetchOptions.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// updates are always listed from the head of the channel, even when pinned
+	channelUpstream := &ReplicatedUpstream{
+		AppSlug: replicatedUpstream.AppSlug,
+		Channel: replicatedUpstream.Channel,
+	}
+
+	updates, err := listPendingReleases(client, channelUpstream, currentCursor, fetchOptions.License)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pending releases")
+	}
+	if updates != nil {
+		return updates, nil
+	}
+
+	headReq, err := channelUpstream.getRequest("HEAD", fetchOptions.License)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	headResp, err := client.Do(headReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute head request")
+	}
+	defer headResp.Body.Close()
+
+	if headResp.StatusCode == 401 {
+		return nil, errors.New("license was not accepted")
+	}
+	if headResp.StatusCode >= 400 {
+		return nil, errors.Errorf("unexpected result from head request: %d", headResp.StatusCode)
+	}
+
+	updateCursor := headResp.Header.Get("X-Replicated-Sequence")
+	if updateCursor == currentCursor {
+		return []Update{}, nil
+	}
+
+	return []Update{
+		{
+			Cursor:       updateCursor,
+			VersionLabel: headResp.Header.Get("X-Replicated-VersionLabel"),
+		},
+	}, nil
+}
+
+func downloadReplicated(client *http.Client, u *url.URL, localPath string, license *kotsv1beta1.License) (*Upstream, error) {
 	var release *Release
+	var applicationMetadata []byte
+	var applicationMetadataErr error
 
 	if localPath != "" {
 		parsedLocalRelease, err := readReplicatedAppFromLocalPath(localPath)
@@ -71,17 +160,29 @@ func downloadReplicated(u *url.URL, localPath string, license *kotsv1beta1.Licen
 			return nil, errors.Wrap(err, "failed to parse replicated upstream")
 		}
 
-		license, err := getSuccessfulHeadResponse(replicatedUpstream, license)
+		license, err := getSuccessfulHeadResponse(client, replicatedUpstream, license)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to get successful head response")
 		}
 
-		downloadedRelease, err := downloadReplicatedApp(replicatedUpstream, license)
+		downloadedRelease, err := downloadReplicatedApp(client, replicatedUpstream, license)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to download replicated app")
 		}
 
+		if err := replicatedUpstream.verifyPinnedRelease(downloadedRelease); err != nil {
+			return nil, errors.Wrap(err, "failed to download pinned release")
+		}
+
 		release = downloadedRelease
+
+		// the release is usable without metadata, so a failure doesn't fail the pull
+		metadata, err := getApplicationMetadata(client, replicatedUpstream, license)
+		if err != nil {
+			applicationMetadataErr = errors.Wrap(err, "failed to get application metadata")
+		} else {
+			applicationMetadata = metadata
+		}
 	}
 
 	// Find the config in the upstream and write out default values
@@ -107,17 +208,90 @@ func downloadReplicated(u *url.URL, localPath string, license *kotsv1beta1.Licen
 	}
 
 	upstream := &Upstream{
-		URI:          u.RequestURI(),
-		Name:         application.Name,
-		Files:        files,
-		Type:         "replicated",
-		UpdateCursor: release.UpdateCursor,
-		VersionLabel: release.VersionLabel,
+		URI:                 util.RemoveURLCredentials(u.String()),
+		Name:                application.Name,
+		Files:               files,
+		Type:                "replicated",
+		UpdateCursor:        release.UpdateCursor,
+		VersionLabel:        release.VersionLabel,
+		ReleaseNotes:        release.ReleaseNotes,
+		ReleasedAt:          release.ReleasedAt,
+		ChannelName:         release.ChannelName,
+		ApplicationMetadata: applicationMetadata,
+
+		ApplicationMetadataErr: applicationMetadataErr,
 	}
 
 	return upstream, nil
 }
 
+// pendingReleases is the response of the pending releases api
+type pendingReleases struct {
+	ChannelReleases []pendingRelease `json:"channelReleases"`
+}
+
+// pendingRelease is a release that was promoted to the channel after the current one
+type pendingRelease struct {
+	ChannelSequence int    `json:"channelSequence"`
+	VersionLabel    string `json:"versionLabel"`
+	ReleaseNotes    string `json:"releaseNotes"`
+}
+
+// listPendingReleases returns the releases in the channel that are newer than the
+// current sequence, or nil if the server can't list them
+func listPendingReleases(client *http.Client, r *ReplicatedUpstream, currentCursor string, license *kotsv1beta1.License) ([]Update, error) {
+	// the channel is a param, so that a channel can't be mistaken for the path
+	appUpstream := &ReplicatedUpstream{
+		AppSlug: r.AppSlug,
+	}
+	req, err := appUpstream.getRequest("GET", license)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	req.URL.Path = fmt.Sprintf("%s/pending-releases", req.URL.Path)
+
+	query := url.Values{}
+	if r.Channel != nil {
+		query.Set("channel", *r.Channel)
+	}
+	if currentCursor != "" {
+		query.Set("channelSequence", currentCursor)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute get request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if resp.StatusCode == 401 {
+		return nil, errors.New("license was not accepted")
+	}
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("unexpected result from get request: %d", resp.StatusCode)
+	}
+
+	pending := pendingReleases{}
+	if err := stdjson.NewDecoder(resp.Body).Decode(&pending); err != nil {
+		return nil, errors.Wrap(err, "failed to decode pending releases")
+	}
+
+	updates := []Update{}
+	for _, channelRelease := range pending.ChannelReleases {
+		updates = append(updates, Update{
+			Cursor:       strconv.Itoa(channelRelease.ChannelSequence),
+			VersionLabel: channelRelease.VersionLabel,
+			ReleaseNotes: channelRelease.ReleaseNotes,
+		})
+	}
+
+	return updates, nil
+}
+
 func (r *ReplicatedUpstream) getRequest(method string, license *kotsv1beta1.License) (*http.Request, error) {
 	u, err := url.Parse(license.Spec.Endpoint)
 	if err != nil {
@@ -129,12 +303,25 @@ func (r *ReplicatedUpstream) getRequest(method string, license *kotsv1beta1.Lice
 		hostname = fmt.Sprintf("%s:%s", u.Hostname(), u.Port())
 	}
 
+	// pin the release, otherwise the server returns the head of the channel
+	query := url.Values{}
+	if r.VersionLabel != nil {
+		query.Set("versionLabel", *r.VersionLabel)
+	}
+	if r.Sequence != nil {
+		query.Set("sequence", strconv.Itoa(*r.Sequence))
+	}
+
 	url := fmt.Sprintf("%s://%s/release/%s", u.Scheme, hostname, license.Spec.AppSlug)
 
 	if r.Channel != nil {
 		url = fmt.Sprintf("%s/%s", url, *r.Channel)
 	}
 
+	if len(query) > 0 {
+		url = fmt.Sprintf("%s?%s", url, query.Encode())
+	}
+
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to call newrequest")
@@ -145,6 +332,9 @@ func (r *ReplicatedUpstream) getRequest(method string, license *kotsv1beta1.Lice
 	return req, nil
 }
 
+// parseReplicatedURL parses replicated://app-slug/channel uris. The release can be
+// pinned with a version label (replicated://app-slug@v1.2.0/channel) or with a
+// sequence (replicated://app-slug/channel?sequence=42).
 func parseReplicatedURL(u *url.URL) (*ReplicatedUpstream, error) {
 	replicatedUpstream := ReplicatedUpstream{}
 
@@ -158,27 +348,50 @@ func parseReplicatedURL(u *url.URL) (*ReplicatedUpstream, error) {
 
 	if replicatedUpstream.AppSlug == "" {
 		replicatedUpstream.AppSlug = u.Hostname()
-		if u.Path != "" {
-			channel := strings.TrimPrefix(u.Path, "/")
-			replicatedUpstream.Channel = &channel
+	}
+
+	if channel := strings.Trim(u.Path, "/"); channel != "" {
+		replicatedUpstream.Channel = &channel
+	}
+
+	if sequenceParam := u.Query().Get("sequence"); sequenceParam != "" {
+		sequence, err := strconv.Atoi(sequenceParam)
+		if err != nil || sequence < 0 {
+			return nil, errors.Errorf("invalid sequence %q", sequenceParam)
 		}
+		replicatedUpstream.Sequence = &sequence
 	}
 
 	return &replicatedUpstream, nil
 }
 
-func getSuccessfulHeadResponse(replicatedUpstream *ReplicatedUpstream, license *kotsv1beta1.License) (*kotsv1beta1.License, error) {
+// verifyPinnedRelease returns an error if the release that the server returned is
+// not the release that the upstream is pinned to
+func (r *ReplicatedUpstream) verifyPinnedRelease(release *Release) error {
+	if r.Sequence != nil && release.UpdateCursor != strconv.Itoa(*r.Sequence) {
+		return errors.Errorf("requested sequence %d, but the server returned sequence %q", *r.Sequence, release.UpdateCursor)
+	}
+
+	if r.VersionLabel != nil && release.VersionLabel != *r.VersionLabel {
+		return errors.Errorf("requested version %s, but the server returned version %q", *r.VersionLabel, release.VersionLabel)
+	}
+
+	return nil
+}
+
+func getSuccessfulHeadResponse(client *http.Client, replicatedUpstream *ReplicatedUpstream, license *kotsv1beta1.License) (*kotsv1beta1.License, error) {
 	headReq, err := replicatedUpstream.getRequest("HEAD", license)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create http request")
 	}
-	headResp, err := http.DefaultClient.Do(headReq)
+	headResp, err := client.Do(headReq)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to execute head request")
 	}
+	defer headResp.Body.Close()
 
 	if headResp.StatusCode == 401 {
-		return nil, errors.Wrap(err, "license was not accepted")
+		return nil, errors.New("license was not accepted")
 	}
 
 	if headResp.StatusCode >= 400 {
@@ -224,12 +437,12 @@ func readReplicatedAppFromLocalPath(localPath string) (*Release, error) {
 	return &release, nil
 }
 
-func downloadReplicatedApp(replicatedUpstream *ReplicatedUpstream, license *kotsv1beta1.License) (*Release, error) {
+func downloadReplicatedApp(client *http.Client, replicatedUpstream *ReplicatedUpstream, license *kotsv1beta1.License) (*Release, error) {
 	getReq, err := replicatedUpstream.getRequest("GET", license)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create http request")
 	}
-	getResp, err := http.DefaultClient.Do(getReq)
+	getResp, err := client.Do(getReq)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to execute get request")
 	}
@@ -240,49 +453,41 @@ func downloadReplicatedApp(replicatedUpstream *ReplicatedUpstream, license *kots
 
 	defer getResp.Body.Close()
 
-	updateCursor := getResp.Header.Get("X-Replicated-Sequence")
-	versionLabel := getResp.Header.Get("X-Replicated-VersionLabel")
-
-	gzf, err := gzip.NewReader(getResp.Body)
+	files, err := archive.ReadTarGz(getResp.Body, archive.Options{})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create new gzip reader")
+		return nil, errors.Wrap(err, "failed to read release archive")
 	}
 
-	release := Release{
-		Manifests:    make(map[string][]byte),
-		UpdateCursor: updateCursor,
-		VersionLabel: versionLabel,
+	release := releaseFromHeaders(getResp.Header)
+	for _, file := range files {
+		release.Manifests[file.Path] = file.Content
 	}
-	tarReader := tar.NewReader(gzf)
-	i := 0
-	for {
-		header, err := tarReader.Next()
-
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to get next file from reader")
-		}
 
-		name := header.Name
+	return release, nil
+}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			continue
-		case tar.TypeReg:
-			content, err := ioutil.ReadAll(tarReader)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to read file from tar")
-			}
+// releaseFromHeaders reads the release metadata that is returned in the headers of
+// the release archive. Release notes are percent encoded because they can have more
+// than one line.
+func releaseFromHeaders(header http.Header) *Release {
+	release := Release{
+		Manifests:    make(map[string][]byte),
+		UpdateCursor: header.Get("X-Replicated-Sequence"),
+		VersionLabel: header.Get("X-Replicated-VersionLabel"),
+		ChannelName:  header.Get("X-Replicated-ChannelName"),
+	}
 
-			release.Manifests[name] = content
-		}
+	releaseNotes := header.Get("X-Replicated-ReleaseNotes")
+	if unescaped, err := url.PathUnescape(releaseNotes); err == nil {
+		releaseNotes = unescaped
+	}
+	release.ReleaseNotes = releaseNotes
 
-		i++
+	if releasedAt, err := time.Parse(time.RFC3339, header.Get("X-Replicated-ReleasedAt")); err == nil {
+		release.ReleasedAt = &releasedAt
 	}
 
-	return &release, nil
+	return &release
 }
 
 func mustMarshalLicense(license *kotsv1beta1.License) []byte {
@@ -460,64 +665,3 @@ func releaseToFiles(release *Release) ([]UpstreamFile, error) {
 
 	return upstreamFiles, nil
 }
-
-// GetApplicationMetadata will return any available application yaml from
-// the upstream. If there is no application.yaml, it will return
-// a placeholder one
-func GetApplicationMetadata(upstream *url.URL) ([]byte, error) {
-	metadata, err := getApplicationMetadataFromHost("replicated.app", upstream)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get metadata from replicated.app")
-	}
-
-	if metadata == nil {
-		otherMetadata, err := getApplicationMetadataFromHost("staging.replicated.app", upstream)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to get metadata from staging.replicated.app")
-		}
-
-		metadata = otherMetadata
-	}
-
-	if metadata == nil {
-		metadata = []byte(DefaultMetadata)
-	}
-
-	return metadata, nil
-}
-
-func getApplicationMetadataFromHost(host string, upstream *url.URL) ([]byte, error) {
-	r, err := parseReplicatedURL(upstream)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse replicated upstream")
-	}
-
-	url := fmt.Sprintf("https://%s/metadata/%s", host, r.AppSlug)
-
-	if r.Channel != nil {
-		url = fmt.Sprintf("%s/%s", url, *r.Channel)
-	}
-
-	getReq, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to call newrequest")
-	}
-
-	getResp, err := http.DefaultClient.Do(getReq)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute get request")
-	}
-
-	if getResp.StatusCode == 404 {
-		// no metadata is not an error
-		return nil, nil
-	}
-
-	if getResp.StatusCode >= 400 {
-		return nil, errors.Errorf("expected result from get request: %d", getResp.StatusCode)
-	}
-
-	defer getResp.Body.Close()
-
-	return nil, nil
-}
@@ -1,16 +1,25 @@
 package upstream
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	kotsv1beta1 "github.com/replicatedhq/kots/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/kots/pkg/releaseserver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var (
-	v1_2_0  = "v1.2.0"
-	channel = "channel"
+	v1_2_0      = "v1.2.0"
+	channel     = "channel"
+	sequence_42 = 42
 )
 
 func Test_parseReplicatedURL(t *testing.T) {
@@ -21,6 +30,7 @@ func Test_parseReplicatedURL(t *testing.T) {
 		expectedChannel      *string
 		expectedVersionLabel *string
 		expectedSequence     *int
+		expectErr            bool
 	}{
 		{
 			name:                 "replicated://app-slug",
@@ -46,6 +56,27 @@ func Test_parseReplicatedURL(t *testing.T) {
 			expectedVersionLabel: nil,
 			expectedSequence:     nil,
 		},
+		{
+			name:                 "replicated://app-slug@v1.2.0/channel",
+			uri:                  "replicated://app-slug@v1.2.0/channel",
+			expectedAppSlug:      "app-slug",
+			expectedChannel:      &channel,
+			expectedVersionLabel: &v1_2_0,
+			expectedSequence:     nil,
+		},
+		{
+			name:                 "replicated://app-slug/channel?sequence=42",
+			uri:                  "replicated://app-slug/channel?sequence=42",
+			expectedAppSlug:      "app-slug",
+			expectedChannel:      &channel,
+			expectedVersionLabel: nil,
+			expectedSequence:     &sequence_42,
+		},
+		{
+			name:      "replicated://app-slug?sequence=latest",
+			uri:       "replicated://app-slug?sequence=latest",
+			expectErr: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -56,8 +87,14 @@ func Test_parseReplicatedURL(t *testing.T) {
 			req.NoError(err)
 
 			replicatedUpstream, err := parseReplicatedURL(u)
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
 			req.NoError(err)
 			assert.Equal(t, test.expectedAppSlug, replicatedUpstream.AppSlug)
+			assert.Equal(t, test.expectedChannel, replicatedUpstream.Channel)
+			assert.Equal(t, test.expectedSequence, replicatedUpstream.Sequence)
 
 			if test.expectedVersionLabel != nil || replicatedUpstream.VersionLabel != nil {
 				assert.Equal(t, test.expectedVersionLabel, replicatedUpstream.VersionLabel)
@@ -147,3 +184,291 @@ func Test_releaseToFiles(t *testing.T) {
 		})
 	}
 }
+
+func Test_downloadReplicatedPinned(t *testing.T) {
+	releases := map[string]string{
+		"1": "v1.0.0",
+		"2": "v1.1.0",
+		"3": "v1.2.0",
+	}
+	release := mustCreateTarGz(t, map[string]string{
+		"manifests/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment",
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/release/app-slug/stable" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		sequence := "3"
+		if r.URL.Query().Get("sequence") != "" {
+			sequence = r.URL.Query().Get("sequence")
+		}
+		if versionLabel := r.URL.Query().Get("versionLabel"); versionLabel != "" {
+			sequence = ""
+			for s, v := range releases {
+				if v == versionLabel {
+					sequence = s
+				}
+			}
+		}
+		// sequence 2 was replaced, and the server returns the head instead
+		if sequence == "2" {
+			sequence = "3"
+		}
+
+		versionLabel, ok := releases[sequence]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Replicated-Sequence", sequence)
+		w.Header().Set("X-Replicated-VersionLabel", versionLabel)
+		w.Write(release)
+	}))
+	defer server.Close()
+
+	license := &kotsv1beta1.License{
+		Spec: kotsv1beta1.LicenseSpec{
+			AppSlug:   "app-slug",
+			Endpoint:  server.URL,
+			LicenseID: "license-id",
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		uri                  string
+		expectedCursor       string
+		expectedVersionLabel string
+		expectErr            bool
+	}{
+		{
+			name:                 "channel head",
+			uri:                  "replicated://app-slug/stable",
+			expectedCursor:       "3",
+			expectedVersionLabel: "v1.2.0",
+		},
+		{
+			name:                 "pinned sequence",
+			uri:                  "replicated://app-slug/stable?sequence=1",
+			expectedCursor:       "1",
+			expectedVersionLabel: "v1.0.0",
+		},
+		{
+			name:                 "pinned version label",
+			uri:                  "replicated://app-slug@v1.0.0/stable",
+			expectedCursor:       "1",
+			expectedVersionLabel: "v1.0.0",
+		},
+		{
+			name:      "server returns a different sequence",
+			uri:       "replicated://app-slug/stable?sequence=2",
+			expectErr: true,
+		},
+		{
+			name:      "unknown version label",
+			uri:       "replicated://app-slug@v9.9.9/stable",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			u, err := url.ParseRequestURI(test.uri)
+			req.NoError(err)
+
+			replicatedUpstream, err := parseReplicatedURL(u)
+			req.NoError(err)
+
+			release, err := downloadReplicatedApp(http.DefaultClient, replicatedUpstream, license)
+			if err == nil {
+				err = replicatedUpstream.verifyPinnedRelease(release)
+			}
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			assert.Equal(t, test.expectedCursor, release.UpdateCursor)
+			assert.Equal(t, test.expectedVersionLabel, release.VersionLabel)
+		})
+	}
+}
+
+func Test_replicatedListUpdates(t *testing.T) {
+	req := require.New(t)
+
+	releasesDir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(releasesDir)
+
+	for _, releaseDir := range []string{"stable/1-v1.0.0", "stable/2-v1.1.0", "stable/3-v1.2.0", "beta/4-v1.3.0-beta", "pending/5-v2.0.0", "pending/6-v2.1.0"} {
+		req.NoError(os.MkdirAll(filepath.Join(releasesDir, releaseDir), 0755))
+		req.NoError(ioutil.WriteFile(filepath.Join(releasesDir, releaseDir, "deployment.yaml"), []byte("kind: Deployment"), 0644))
+	}
+
+	license := &kotsv1beta1.License{
+		Spec: kotsv1beta1.LicenseSpec{
+			AppSlug:   "app-slug",
+			LicenseID: "license-id",
+		},
+	}
+
+	releaseServer, err := releaseserver.NewServer(releasesDir, []*kotsv1beta1.License{license})
+	req.NoError(err)
+	server := httptest.NewServer(releaseServer)
+	defer server.Close()
+	license.Spec.Endpoint = server.URL
+
+	// this server can't list pending releases, only return the head of the channel
+	headServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" || r.URL.Path != "/release/app-slug/stable" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Replicated-Sequence", "3")
+		w.Header().Set("X-Replicated-VersionLabel", "v1.2.0")
+	}))
+	defer headServer.Close()
+
+	headLicense := license.DeepCopy()
+	headLicense.Spec.Endpoint = headServer.URL
+
+	tests := []struct {
+		name          string
+		uri           string
+		license       *kotsv1beta1.License
+		currentCursor string
+		expected      []Update
+	}{
+		{
+			name:          "pending releases",
+			uri:           "replicated://app-slug/stable",
+			license:       license,
+			currentCursor: "1",
+			expected: []Update{
+				{Cursor: "2", VersionLabel: "v1.1.0"},
+				{Cursor: "3", VersionLabel: "v1.2.0"},
+			},
+		},
+		{
+			name:          "pinned",
+			uri:           "replicated://app-slug@v1.0.0/stable",
+			license:       license,
+			currentCursor: "1",
+			expected: []Update{
+				{Cursor: "2", VersionLabel: "v1.1.0"},
+				{Cursor: "3", VersionLabel: "v1.2.0"},
+			},
+		},
+		{
+			name:          "channel named pending",
+			uri:           "replicated://app-slug/pending",
+			license:       license,
+			currentCursor: "5",
+			expected: []Update{
+				{Cursor: "6", VersionLabel: "v2.1.0"},
+			},
+		},
+		{
+			name:          "up to date",
+			uri:           "replicated://app-slug/stable",
+			license:       license,
+			currentCursor: "3",
+			expected:      []Update{},
+		},
+		{
+			name:          "head of channel",
+			uri:           "replicated://app-slug/stable",
+			license:       headLicense,
+			currentCursor: "1",
+			expected: []Update{
+				{Cursor: "3", VersionLabel: "v1.2.0"},
+			},
+		},
+		{
+			name:          "head of channel up to date",
+			uri:           "replicated://app-slug/stable",
+			license:       headLicense,
+			currentCursor: "3",
+			expected:      []Update{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			updates, err := ListUpdates(test.uri, test.currentCursor, &FetchOptions{License: test.license})
+			req.NoError(err)
+			assert.Equal(t, test.expected, updates)
+		})
+	}
+}
+
+func Test_releaseFromHeaders(t *testing.T) {
+	releasedAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected *Release
+	}{
+		{
+			name: "all metadata",
+			headers: map[string]string{
+				"X-Replicated-Sequence":     "42",
+				"X-Replicated-VersionLabel": "v1.2.0",
+				"X-Replicated-ChannelName":  "Stable",
+				"X-Replicated-ReleasedAt":   "2019-10-01T12:00:00Z",
+				"X-Replicated-ReleaseNotes": url.PathEscape("Fixes the thing\n\nAnd 100% more"),
+			},
+			expected: &Release{
+				UpdateCursor: "42",
+				VersionLabel: "v1.2.0",
+				ChannelName:  "Stable",
+				ReleasedAt:   &releasedAt,
+				ReleaseNotes: "Fixes the thing\n\nAnd 100% more",
+				Manifests:    map[string][]byte{},
+			},
+		},
+		{
+			name: "sequence only",
+			headers: map[string]string{
+				"X-Replicated-Sequence": "42",
+			},
+			expected: &Release{
+				UpdateCursor: "42",
+				Manifests:    map[string][]byte{},
+			},
+		},
+		{
+			name: "release notes that are not encoded",
+			headers: map[string]string{
+				"X-Replicated-Sequence":     "42",
+				"X-Replicated-ReleaseNotes": "100% more",
+			},
+			expected: &Release{
+				UpdateCursor: "42",
+				ReleaseNotes: "100% more",
+				Manifests:    map[string][]byte{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range test.headers {
+				header.Set(k, v)
+			}
+
+			assert.Equal(t, test.expected, releaseFromHeaders(header))
+		})
+	}
+}
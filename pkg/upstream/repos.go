@@ -1,8 +1,233 @@
 package upstream
 
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"k8s.io/helm/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// KnownRepos are the helm repos that are available without being added
 var KnownRepos = map[string]string{
-	"stable":  "https://kubernetes-charts.storage.googleapis.com",
+	"stable":  "https://charts.helm.sh/stable",
 	"local":   "http://127.0.0.1:8879",
 	"elastic": "https://helm.elastic.co",
 	"gomods":  "https://athens.blob.core.windows.net/charts",
 }
+
+// HelmRepo is a helm repo alias, along with the credentials to use with it
+type HelmRepo struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	CAFile   string `json:"caFile,omitempty"`
+}
+
+// HelmRepos is the file that kots repo add/list/remove manage
+type HelmRepos struct {
+	Repositories []HelmRepo `json:"repositories"`
+}
+
+// DefaultHelmReposFile returns the location of the helm repos file when
+// KOTS_REPOSITORIES_FILE is not set
+func DefaultHelmReposFile() string {
+	if reposFile := os.Getenv("KOTS_REPOSITORIES_FILE"); reposFile != "" {
+		return reposFile
+	}
+
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" {
+		homeDir = os.Getenv("USERPROFILE")
+	}
+
+	return filepath.Join(homeDir, ".kots", "repositories.yaml")
+}
+
+// DefaultHelmRepositoriesFile returns the location of the helm client's own
+// repositories.yaml, preferring helm 3 when both are present
+func DefaultHelmRepositoriesFile() string {
+	if helmConfig := os.Getenv("HELM_REPOSITORY_CONFIG"); helmConfig != "" {
+		return helmConfig
+	}
+
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" {
+		homeDir = os.Getenv("USERPROFILE")
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	helm3File := filepath.Join(configHome, "helm", "repositories.yaml")
+	if _, err := os.Stat(helm3File); err == nil {
+		return helm3File
+	}
+
+	helmHome := os.Getenv("HELM_HOME")
+	if helmHome == "" {
+		helmHome = filepath.Join(homeDir, ".helm")
+	}
+	return filepath.Join(helmHome, "repository", "repositories.yaml")
+}
+
+// LoadHelmRepos reads the helm repos file. A missing file has no repos.
+func LoadHelmRepos(filename string) (*HelmRepos, error) {
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &HelmRepos{Repositories: []HelmRepo{}}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read repos file")
+	}
+
+	helmRepos := HelmRepos{}
+	if err := yaml.Unmarshal(content, &helmRepos); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal repos file")
+	}
+	if helmRepos.Repositories == nil {
+		helmRepos.Repositories = []HelmRepo{}
+	}
+
+	return &helmRepos, nil
+}
+
+// Save writes the helm repos file. The file can contain credentials, so it is only
+// readable by the owner.
+func (r *HelmRepos) Save(filename string) error {
+	sort.Slice(r.Repositories, func(i, j int) bool {
+		return r.Repositories[i].Name < r.Repositories[j].Name
+	})
+
+	content, err := yaml.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal repos file")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return errors.Wrap(err, "failed to create repos file dir")
+	}
+
+	if err := ioutil.WriteFile(filename, content, 0600); err != nil {
+		return errors.Wrap(err, "failed to write repos file")
+	}
+
+	return nil
+}
+
+// Get returns the repo with the name, or nil
+func (r *HelmRepos) Get(name string) *HelmRepo {
+	for i, helmRepo := range r.Repositories {
+		if helmRepo.Name == name {
+			return &r.Repositories[i]
+		}
+	}
+
+	return nil
+}
+
+// Add adds the repo, replacing any existing repo with the same name
+func (r *HelmRepos) Add(helmRepo HelmRepo) error {
+	if helmRepo.Name == "" {
+		return errors.New("repo name is required")
+	}
+	if helmRepo.URL == "" {
+		return errors.New("repo url is required")
+	}
+
+	if existing := r.Get(helmRepo.Name); existing != nil {
+		*existing = helmRepo
+		return nil
+	}
+
+	r.Repositories = append(r.Repositories, helmRepo)
+	return nil
+}
+
+// Remove removes the repo with the name
+func (r *HelmRepos) Remove(name string) error {
+	for i, helmRepo := range r.Repositories {
+		if helmRepo.Name == name {
+			r.Repositories = append(r.Repositories[:i], r.Repositories[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.Errorf("repo %q not found", name)
+}
+
+// ImportHelmRepositories returns the repos in a helm client repositories.yaml
+func ImportHelmRepositories(filename string) ([]HelmRepo, error) {
+	repoFile, err := repo.LoadRepositoriesFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load helm repositories file")
+	}
+
+	helmRepos := []HelmRepo{}
+	for _, entry := range repoFile.Repositories {
+		helmRepos = append(helmRepos, HelmRepo{
+			Name:     entry.Name,
+			URL:      entry.URL,
+			Username: entry.Username,
+			Password: entry.Password,
+			CertFile: entry.CertFile,
+			KeyFile:  entry.KeyFile,
+			CAFile:   entry.CAFile,
+		})
+	}
+
+	return helmRepos, nil
+}
+
+// getKnownHelmRepo returns the repo for the name from the repos file, falling back
+// to the built in repos. Nil is returned if the name is not known.
+func getKnownHelmRepo(repoName string, reposFile string) (*HelmRepo, error) {
+	if reposFile == "" {
+		reposFile = DefaultHelmReposFile()
+	}
+
+	helmRepos, err := LoadHelmRepos(reposFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load repos")
+	}
+
+	if helmRepo := helmRepos.Get(repoName); helmRepo != nil {
+		return helmRepo, nil
+	}
+
+	if repoURI, ok := KnownRepos[repoName]; ok {
+		return &HelmRepo{
+			Name: repoName,
+			URL:  repoURI,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// withHelmRepoAuth returns a copy of the fetch options with the credentials of the
+// repo filled in where the fetch options don't have them
+func withHelmRepoAuth(fetchOptions *FetchOptions, helmRepo *HelmRepo) *FetchOptions {
+	withAuth := *fetchOptions
+
+	if withAuth.HelmRepoUsername == "" && withAuth.HelmRepoPassword == "" {
+		withAuth.HelmRepoUsername = helmRepo.Username
+		withAuth.HelmRepoPassword = helmRepo.Password
+	}
+	if withAuth.HelmRepoCertFile == "" && withAuth.HelmRepoKeyFile == "" {
+		withAuth.HelmRepoCertFile = helmRepo.CertFile
+		withAuth.HelmRepoKeyFile = helmRepo.KeyFile
+	}
+	if withAuth.HelmRepoCAFile == "" {
+		withAuth.HelmRepoCAFile = helmRepo.CAFile
+	}
+
+	return &withAuth
+}
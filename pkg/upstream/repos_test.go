@@ -0,0 +1,102 @@
+package upstream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HelmRepos(t *testing.T) {
+	req := require.New(t)
+
+	dir, err := ioutil.TempDir("", "kots")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+	reposFile := filepath.Join(dir, "kots", "repositories.yaml")
+
+	helmRepos, err := LoadHelmRepos(reposFile)
+	req.NoError(err)
+	assert.Empty(t, helmRepos.Repositories)
+
+	req.NoError(helmRepos.Add(HelmRepo{Name: "stable", URL: "https://charts.example.com/stable"}))
+	req.NoError(helmRepos.Add(HelmRepo{Name: "mycorp", URL: "https://charts.mycorp.com", Username: "user", Password: "pass"}))
+	req.NoError(helmRepos.Add(HelmRepo{Name: "other", URL: "https://charts.example.com/other"}))
+	req.Error(helmRepos.Add(HelmRepo{Name: "nourl"}))
+	req.NoError(helmRepos.Remove("other"))
+	req.Error(helmRepos.Remove("other"))
+	req.NoError(helmRepos.Save(reposFile))
+
+	info, err := os.Stat(reposFile)
+	req.NoError(err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// repos in the file take precedence over the built in repos
+	helmRepo, err := getKnownHelmRepo("stable", reposFile)
+	req.NoError(err)
+	assert.Equal(t, "https://charts.example.com/stable", helmRepo.URL)
+
+	helmRepo, err = getKnownHelmRepo("mycorp", reposFile)
+	req.NoError(err)
+	assert.Equal(t, &HelmRepo{Name: "mycorp", URL: "https://charts.mycorp.com", Username: "user", Password: "pass"}, helmRepo)
+
+	helmRepo, err = getKnownHelmRepo("elastic", reposFile)
+	req.NoError(err)
+	assert.Equal(t, KnownRepos["elastic"], helmRepo.URL)
+
+	helmRepo, err = getKnownHelmRepo("other", reposFile)
+	req.NoError(err)
+	assert.Nil(t, helmRepo)
+}
+
+func Test_ImportHelmRepositories(t *testing.T) {
+	req := require.New(t)
+
+	helmRepositories, err := ioutil.TempFile("", "kots")
+	req.NoError(err)
+	defer os.Remove(helmRepositories.Name())
+
+	_, err = helmRepositories.WriteString(`apiVersion: v1
+generated: "2019-10-01T00:00:00Z"
+repositories:
+- name: mycorp
+  url: https://charts.mycorp.com
+  cache: /home/user/.helm/repository/cache/mycorp-index.yaml
+  username: user
+  password: pass
+  caFile: /etc/mycorp/ca.pem
+`)
+	req.NoError(err)
+	req.NoError(helmRepositories.Close())
+
+	helmRepos, err := ImportHelmRepositories(helmRepositories.Name())
+	req.NoError(err)
+	assert.Equal(t, []HelmRepo{
+		{
+			Name:     "mycorp",
+			URL:      "https://charts.mycorp.com",
+			Username: "user",
+			Password: "pass",
+			CAFile:   "/etc/mycorp/ca.pem",
+		},
+	}, helmRepos)
+}
+
+func Test_withHelmRepoAuth(t *testing.T) {
+	helmRepo := &HelmRepo{Name: "mycorp", URL: "https://charts.mycorp.com", Username: "user", Password: "pass", CAFile: "ca.pem"}
+
+	fetchOptions := &FetchOptions{}
+	withAuth := withHelmRepoAuth(fetchOptions, helmRepo)
+	assert.Equal(t, "user", withAuth.HelmRepoUsername)
+	assert.Equal(t, "pass", withAuth.HelmRepoPassword)
+	assert.Equal(t, "ca.pem", withAuth.HelmRepoCAFile)
+	assert.Equal(t, "", fetchOptions.HelmRepoUsername)
+
+	// credentials that were passed explicitly win
+	withAuth = withHelmRepoAuth(&FetchOptions{HelmRepoUsername: "other"}, helmRepo)
+	assert.Equal(t, "other", withAuth.HelmRepoUsername)
+	assert.Equal(t, "", withAuth.HelmRepoPassword)
+}
@@ -0,0 +1,71 @@
+package upstream
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/kots/pkg/util"
+)
+
+// Update is a version of the upstream that is newer than the version that was pulled
+type Update struct {
+	Cursor       string `json:"cursor"`
+	VersionLabel string `json:"versionLabel,omitempty"`
+	ReleaseNotes string `json:"releaseNotes,omitempty"`
+}
+
+// UpdateLister is implemented by providers that can list the pending updates of an
+// upstream without downloading it
+type UpdateLister interface {
+	// ListUpdates returns the versions that are newer than currentCursor, oldest first.
+	ListUpdates(u *url.URL, currentCursor string, fetchOptions *FetchOptions) ([]Update, error)
+}
+
+// ListUpdates returns the versions of the upstream that are newer than currentCursor,
+// oldest first. Providers that can't list updates fall back to fetching the upstream,
+// which finds the latest version only.
+func ListUpdates(upstreamURI string, currentCursor string, fetchOptions *FetchOptions) ([]Update, error) {
+	upstreamURI = kustomizeRemoteTargetURI(upstreamURI)
+	if !util.IsURL(upstreamURI) {
+		return nil, errors.New("updates can only be listed for upstream uris")
+	}
+
+	u, provider, err := getProviderForURI(upstreamURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if fetchOptions == nil {
+		fetchOptions = &FetchOptions{}
+	}
+
+	if lister, ok := provider.(UpdateLister); ok {
+		return lister.ListUpdates(u, currentCursor, fetchOptions)
+	}
+
+	upstream, err := provider.Fetch(u, fetchOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch upstream")
+	}
+
+	if upstream.UpdateCursor == currentCursor {
+		return []Update{}, nil
+	}
+
+	return []Update{
+		{
+			Cursor:       upstream.UpdateCursor,
+			VersionLabel: upstream.VersionLabel,
+		},
+	}, nil
+}
+
+// checkForUpdatesByListing is used by providers that implement UpdateLister
+func checkForUpdatesByListing(l UpdateLister, u *url.URL, currentCursor string, fetchOptions *FetchOptions) (bool, error) {
+	updates, err := l.ListUpdates(u, currentCursor, fetchOptions)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list updates")
+	}
+
+	return len(updates) > 0, nil
+}
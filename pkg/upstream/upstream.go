@@ -1,15 +1,47 @@
 package upstream
 
+import (
+	"time"
+)
+
+// HelmValuesPath is the file in helm upstreams with the values that the chart is
+// rendered with
+const HelmValuesPath = "userdata/values.yaml"
+
 type UpstreamFile struct {
 	Path    string
 	Content []byte
 }
 
 type Upstream struct {
-	URI          string
-	Name         string
-	Type         string
-	Files        []UpstreamFile
-	UpdateCursor string
-	VersionLabel string
+	URI                 string
+	Name                string
+	Type                string
+	Files               []UpstreamFile
+	UpdateCursor        string
+	VersionLabel        string
+	ReleaseNotes        string
+	ReleasedAt          *time.Time
+	ChannelName         string
+	ApplicationMetadata []byte
+
+	// ApplicationMetadataErr is why the application metadata couldn't be fetched.
+	// Metadata is best effort, the cached metadata is written instead.
+	ApplicationMetadataErr error
+}
+
+// GetHelmValues returns the values that a helm upstream is rendered with, or nil if
+// there are none
+func (u *Upstream) GetHelmValues() []byte {
+	if u.Type != "helm" {
+		return nil
+	}
+
+	for _, file := range u.Files {
+		if file.Path == HelmValuesPath {
+			return file.Content
+		}
+	}
+
+	return nil
 }
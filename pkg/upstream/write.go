@@ -12,6 +12,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/helm/pkg/chartutil"
 )
 
 type WriteOptions struct {
@@ -19,6 +20,11 @@ type WriteOptions struct {
 	CreateAppDir        bool
 	IncludeAdminConsole bool
 	SharedPassword      string
+
+	// KubeVersion and APIVersions are the capabilities that the upstream is rendered
+	// with, recorded in the installation
+	KubeVersion string
+	APIVersions []string
 }
 
 func (u *Upstream) WriteUpstream(options WriteOptions) error {
@@ -39,6 +45,7 @@ func (u *Upstream) WriteUpstream(options WriteOptions) error {
 	}
 
 	var previousValuesContent []byte
+	var previousApplicationMetadata []byte
 	_, err := os.Stat(renderDir)
 	if err == nil {
 		// if there's already a values yaml, we need to save
@@ -52,6 +59,15 @@ func (u *Upstream) WriteUpstream(options WriteOptions) error {
 			previousValuesContent = c
 		}
 
+		// application metadata can't be fetched for airgapped updates, so keep what
+		// was cached when the app was pulled online
+		c, err := ioutil.ReadFile(path.Join(renderDir, "userdata", ApplicationMetadataFilename))
+		if err == nil {
+			previousApplicationMetadata = c
+		} else if !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to read existing application metadata")
+		}
+
 		if err := os.RemoveAll(renderDir); err != nil {
 			return errors.Wrap(err, "failed to remove previous content in upstream")
 		}
@@ -74,7 +90,12 @@ func (u *Upstream) WriteUpstream(options WriteOptions) error {
 	if previousValuesContent != nil {
 		for i, f := range u.Files {
 			if f.Path == path.Join("userdata", "values.yaml") {
-				mergedValues, err := mergeValues(previousValuesContent, f.Content)
+				var mergedValues []byte
+				if u.Type == "helm" {
+					mergedValues, err = mergeHelmValues(previousValuesContent, f.Content)
+				} else {
+					mergedValues, err = mergeValues(previousValuesContent, f.Content)
+				}
 				if err != nil {
 					return errors.Wrap(err, "failed to merge values")
 				}
@@ -106,8 +127,17 @@ func (u *Upstream) WriteUpstream(options WriteOptions) error {
 		Spec: kotsv1beta1.InstallationSpec{
 			UpdateCursor: u.UpdateCursor,
 			VersionLabel: u.VersionLabel,
+			ReleaseNotes: u.ReleaseNotes,
+			ChannelName:  u.ChannelName,
+			UpstreamURI:  u.URI,
+			KubeVersion:  options.KubeVersion,
+			APIVersions:  options.APIVersions,
 		},
 	}
+	if u.ReleasedAt != nil {
+		releasedAt := metav1.NewTime(*u.ReleasedAt)
+		installation.Spec.ReleasedAt = &releasedAt
+	}
 	if _, err := os.Stat(path.Join(renderDir, "userdata")); os.IsNotExist(err) {
 		if err := os.MkdirAll(path.Join(renderDir, "userdata"), 0755); err != nil {
 			return errors.Wrap(err, "failed to create userdata dir")
@@ -118,6 +148,35 @@ func (u *Upstream) WriteUpstream(options WriteOptions) error {
 		return errors.Wrap(err, "failed to write installation")
 	}
 
+	if err := writeChecksums(renderDir, newChecksums(u.UpdateCursor, u.Files)); err != nil {
+		return errors.Wrap(err, "failed to write checksums")
+	}
+
+	applicationMetadata := u.applicationMetadataToWrite(previousApplicationMetadata)
+	if applicationMetadata != nil {
+		err = ioutil.WriteFile(path.Join(renderDir, "userdata", ApplicationMetadataFilename), applicationMetadata, 0644)
+		if err != nil {
+			return errors.Wrap(err, "failed to write application metadata")
+		}
+	}
+
+	return nil
+}
+
+// applicationMetadataToWrite returns the fetched application metadata, or the cached
+// metadata when there is none. When fetching the metadata failed and nothing is
+// cached, the default metadata is used, like it is when the app has none.
+func (u *Upstream) applicationMetadataToWrite(previousApplicationMetadata []byte) []byte {
+	if u.ApplicationMetadata != nil {
+		return u.ApplicationMetadata
+	}
+	if previousApplicationMetadata != nil {
+		return previousApplicationMetadata
+	}
+	if u.ApplicationMetadataErr != nil {
+		return []byte(DefaultMetadata)
+	}
+
 	return nil
 }
 
@@ -163,6 +222,29 @@ func mergeValues(previousValues []byte, applicationDeliveredValues []byte) ([]by
 	return b.Bytes(), nil
 }
 
+// mergeHelmValues applies the values that were given for this pull on top of the
+// values from the last pull, which may have been edited
+func mergeHelmValues(previousValues []byte, newValues []byte) ([]byte, error) {
+	values, err := chartutil.ReadValues(previousValues)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read previous values")
+	}
+
+	overrides, err := chartutil.ReadValues(newValues)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read new values")
+	}
+
+	values.MergeInto(overrides)
+
+	merged, err := values.YAML()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal merged values")
+	}
+
+	return []byte(merged), nil
+}
+
 func mustMarshalInstallation(installation *kotsv1beta1.Installation) []byte {
 	kotsscheme.AddToScheme(scheme.Scheme)
 
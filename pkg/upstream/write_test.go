@@ -0,0 +1,80 @@
+package upstream
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mergeHelmValues(t *testing.T) {
+	tests := []struct {
+		name           string
+		previousValues string
+		newValues      string
+		expected       string
+	}{
+		{
+			name:           "edited values are kept",
+			previousValues: "image:\n  tag: \"6\"\nreplicas: 2\n",
+			newValues:      "{}\n",
+			expected:       "image:\n  tag: \"6\"\nreplicas: 2\n",
+		},
+		{
+			name:           "new values override previous values",
+			previousValues: "image:\n  repository: redis\n  tag: \"6\"\nreplicas: 2\n",
+			newValues:      "image:\n  tag: \"7\"\n",
+			expected:       "image:\n  repository: redis\n  tag: \"7\"\nreplicas: 2\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, err := mergeHelmValues([]byte(test.previousValues), []byte(test.newValues))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(merged))
+		})
+	}
+}
+
+func Test_applicationMetadataToWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream Upstream
+		previous []byte
+		expected []byte
+	}{
+		{
+			name:     "fetched",
+			upstream: Upstream{ApplicationMetadata: []byte("fetched")},
+			previous: []byte("cached"),
+			expected: []byte("fetched"),
+		},
+		{
+			name:     "no metadata keeps the cache",
+			previous: []byte("cached"),
+			expected: []byte("cached"),
+		},
+		{
+			name:     "failed fetch keeps the cache",
+			upstream: Upstream{ApplicationMetadataErr: errors.New("failed to get application metadata")},
+			previous: []byte("cached"),
+			expected: []byte("cached"),
+		},
+		{
+			name:     "failed fetch without a cache",
+			upstream: Upstream{ApplicationMetadataErr: errors.New("failed to get application metadata")},
+			expected: []byte(DefaultMetadata),
+		},
+		{
+			name: "no metadata without a cache",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.upstream.applicationMetadataToWrite(test.previous))
+		})
+	}
+}
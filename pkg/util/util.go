@@ -6,12 +6,32 @@ import (
 )
 
 func IsURL(str string) bool {
-	_, err := url.ParseRequestURI(str)
+	u, err := url.ParseRequestURI(str)
 	if err != nil {
 		return false
 	}
 
-	return true
+	// absolute filesystem paths parse as request uris, but have no scheme
+	return u.Scheme != ""
+}
+
+// RemoveURLCredentials returns the uri without a password, so that it can be
+// recorded and shared. A username without a password is kept, because it's not
+// always a credential: replicated://app-slug@version-label uses it for the app slug
+// and ssh://git@host for the user to connect as. Strings that aren't urls are
+// returned as they are.
+func RemoveURLCredentials(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return uri
+	}
+
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return uri
+	}
+
+	u.User = nil
+	return u.String()
 }
 
 func CommonSlicePrefix(first []string, second []string) []string {